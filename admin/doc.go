@@ -0,0 +1,5 @@
+// Package admin serves operational endpoints (pprof, load-balancer control
+// and other admin operations) on a listener separate from the public API.
+// Every request must carry the configured token, either as
+// "Authorization: Bearer <token>" or in the X-Admin-Token header.
+package admin
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// LoadBalancer controls whether this instance reports itself healthy to the
+// load balancer.
+type LoadBalancer struct {
+	removed int32
+}
+
+// NewLoadBalancer creates a LoadBalancer in rotation.
+func NewLoadBalancer() *LoadBalancer {
+	return &LoadBalancer{}
+}
+
+// HealthzHandler returns HTTP Status 200 when the application is in rotation,
+// and 403 once it has been removed from the load balancer.
+func (lb *LoadBalancer) HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	if atomic.LoadInt32(&lb.removed) == 1 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveHandler forces the HealthzHandler to return 403 on all subsequent requests so
+// the loadbalancer removes this server from its available pool.
+func (lb *LoadBalancer) RemoveHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	atomic.StoreInt32(&lb.removed, 1)
+	w.WriteHeader(http.StatusOK)
+}
+
+// AddHandler restores the HealthzHandler to 200 so the loadbalancer puts this
+// server back into its available pool.
+func (lb *LoadBalancer) AddHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	atomic.StoreInt32(&lb.removed, 0)
+	w.WriteHeader(http.StatusOK)
+}
+
+// requirePost answers 405 to the requests changing the state which are not
+// POST, and reports whether r is one.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+
+	w.Header().Set("Allow", http.MethodPost)
+	w.WriteHeader(http.StatusMethodNotAllowed)
+
+	return false
+}
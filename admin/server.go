@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+// TokenHeader is the alternative header carrying the admin token.
+const TokenHeader = "X-Admin-Token"
+
+// TokenFunc returns the current admin token. It is called on every request
+// so that a rotated token applies immediately.
+type TokenFunc func() (string, error)
+
+// Server is the admin http server.
+type Server struct {
+	mux   *http.ServeMux
+	token TokenFunc
+}
+
+// NewServer creates an admin server authenticating requests with token.
+func NewServer(token TokenFunc) *Server {
+	return &Server{
+		mux:   http.NewServeMux(),
+		token: token,
+	}
+}
+
+// Handle registers handler for pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers handler for pattern.
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// EnablePprof registers the pprof handlers.
+func (s *Server) EnablePprof() {
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// ServeHTTP authenticates the request and dispatches it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized checks the token of the request. Requests are refused when no
+// token is configured.
+func (s *Server) authorized(r *http.Request) bool {
+	expected, err := s.token()
+	if err != nil {
+		logging.For("admin").Error().Err(err).Msg("unable to resolve admin token")
+		return false
+	}
+
+	if expected == "" {
+		return false
+	}
+
+	got := r.Header.Get(TokenHeader)
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		got = strings.TrimPrefix(h, "Bearer ")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
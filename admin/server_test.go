@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(token string, err error) *Server {
+	s := NewServer(func() (string, error) { return token, err })
+	s.HandleFunc("/ping", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return s
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		err    error
+		header http.Header
+		expect int
+	}{
+		{
+			name:   "1 bearer token",
+			token:  "secret",
+			header: http.Header{"Authorization": []string{"Bearer secret"}},
+			expect: http.StatusNoContent,
+		},
+		{
+			name:   "2 admin token header",
+			token:  "secret",
+			header: http.Header{"X-Admin-Token": []string{"secret"}},
+			expect: http.StatusNoContent,
+		},
+		{
+			name:   "3 wrong token",
+			token:  "secret",
+			header: http.Header{"Authorization": []string{"Bearer nope"}},
+			expect: http.StatusUnauthorized,
+		},
+		{
+			name:   "4 missing token",
+			token:  "secret",
+			header: http.Header{},
+			expect: http.StatusUnauthorized,
+		},
+		{
+			name:   "5 no token configured",
+			token:  "",
+			header: http.Header{"Authorization": []string{"Bearer "}},
+			expect: http.StatusUnauthorized,
+		},
+		{
+			name:   "6 token not resolved",
+			err:    errors.New("missing"),
+			header: http.Header{"Authorization": []string{"Bearer "}},
+			expect: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(tt.token, tt.err)
+
+			r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			r.Header = tt.header
+			w := httptest.NewRecorder()
+
+			s.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expect, w.Code)
+		})
+	}
+}
+
+func TestLoadBalancer(t *testing.T) {
+	lb := NewLoadBalancer()
+
+	healthz := func() int {
+		w := httptest.NewRecorder()
+		lb.HealthzHandler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, healthz())
+
+	lb.RemoveHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/removelb", nil))
+	assert.Equal(t, http.StatusForbidden, healthz())
+
+	lb.AddHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/addlb", nil))
+	assert.Equal(t, http.StatusOK, healthz())
+
+	// only POST changes the state
+	w := httptest.NewRecorder()
+	lb.RemoveHandler(w, httptest.NewRequest(http.MethodGet, "/removelb", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+	assert.Equal(t, http.StatusOK, healthz())
+}
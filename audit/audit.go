@@ -0,0 +1,98 @@
+// Package audit records who submitted which notification, what was decided
+// about it and how its delivery ended. Records go to a dedicated sink, either
+// a rotated JSONL file or a kafka topic, separate from operational logs.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+// Events
+const (
+	EventSubmission = "submission"
+	EventDelivery   = "delivery"
+)
+
+// Decisions
+const (
+	DecisionAccepted  = "accepted"
+	DecisionRejected  = "rejected"
+	DecisionDelivered = "delivered"
+	DecisionFailed    = "failed"
+)
+
+// Caller identifies who made a submission.
+type Caller struct {
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+	UserAgent    string `json:"user_agent,omitempty"`
+}
+
+// Record is an audit entry.
+type Record struct {
+	Time            time.Time `json:"time"`
+	Event           string    `json:"event"`
+	NotificationID  string    `json:"notification_id,omitempty"`
+	Caller          *Caller   `json:"caller,omitempty"`
+	TenantID        string    `json:"tenant_id,omitempty"`
+	Service         string    `json:"service,omitempty"`
+	DestinationHost string    `json:"destination_host,omitempty"`
+	Decision        string    `json:"decision"`
+	Reason          string    `json:"reason,omitempty"`
+	Attempts        int       `json:"attempts,omitempty"`
+}
+
+// Sink stores encoded records.
+type Sink interface {
+	Write(ctx context.Context, b []byte) error
+	Close() error
+}
+
+// Auditor records audit entries.
+type Auditor interface {
+	Record(ctx context.Context, r Record)
+}
+
+type auditor struct {
+	sink Sink
+	now  func() time.Time
+}
+
+// New creates an Auditor writing to sink.
+func New(sink Sink) Auditor {
+	return &auditor{
+		sink: sink,
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Record encodes r and writes it to the sink. Failures are logged, they never
+// fail the audited operation.
+func (a *auditor) Record(ctx context.Context, r Record) {
+	if r.Time.IsZero() {
+		r.Time = a.now()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		logging.For("audit").Error().Err(err).Msg("unable to encode audit record")
+		return
+	}
+
+	if err = a.sink.Write(ctx, b); err != nil {
+		logging.For("audit").Error().Err(err).Str("event", r.Event).Str("notification_id", r.NotificationID).Msg("unable to write audit record")
+	}
+}
+
+type nop struct{}
+
+// Nop returns an Auditor discarding every record.
+func Nop() Auditor {
+	return nop{}
+}
+
+func (nop) Record(context.Context, Record) {}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySink struct {
+	records [][]byte
+}
+
+func (s *memorySink) Write(_ context.Context, b []byte) error {
+	s.records = append(s.records, b)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func Test_auditor_Record(t *testing.T) {
+	sink := &memorySink{}
+	ts := time.Unix(1, 0).UTC()
+
+	a := &auditor{sink: sink, now: func() time.Time { return ts }}
+
+	a.Record(context.Background(), Record{
+		Event:          EventSubmission,
+		NotificationID: "id",
+		Decision:       DecisionAccepted,
+	})
+
+	assert.Len(t, sink.records, 1)
+
+	var got Record
+	assert.NoError(t, json.Unmarshal(sink.records[0], &got))
+	assert.Equal(t, ts, got.Time)
+	assert.Equal(t, "id", got.NotificationID)
+	assert.Equal(t, DecisionAccepted, got.Decision)
+}
+
+func Test_fileSink_Rotates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+
+	s, err := NewFileSink(path, 10, 2)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, r := range []string{"first", "second", "third", "fourth"} {
+		assert.NoError(t, s.Write(ctx, []byte(r)))
+	}
+	assert.NoError(t, s.Close())
+
+	read := func(p string) string {
+		b, err := ioutil.ReadFile(p)
+		assert.NoError(t, err)
+		return strings.TrimSpace(string(b))
+	}
+
+	assert.Equal(t, "fourth", read(path))
+	assert.Equal(t, "third", read(path+".1"))
+	assert.Equal(t, "second", read(path+".2"))
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_fileSink_Keeps_Writing_When_The_Next_File_Cannot_Be_Opened(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+
+	s, err := NewFileSink(path, 10, 2)
+	assert.NoError(t, err)
+
+	// the next file cannot be opened
+	assert.NoError(t, os.Mkdir(path+".next", 0700))
+
+	ctx := context.Background()
+	for _, r := range []string{"first", "second"} {
+		assert.NoError(t, s.Write(ctx, []byte(r)))
+	}
+
+	// the rotation succeeds once it can be opened
+	assert.NoError(t, os.Remove(path+".next"))
+	assert.NoError(t, s.Write(ctx, []byte("third")))
+	assert.NoError(t, s.Close())
+
+	b, err := ioutil.ReadFile(path + ".1")
+	assert.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(b))
+
+	b, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "third\n", string(b))
+}
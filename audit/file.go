@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+// fileSink writes one record per line to a file, rotating it once it grows
+// over maxSize bytes. Rotated files are named path.1 (newest) to
+// path.<maxBackups> (oldest).
+type fileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink creates a sink appending to path. A maxSize of 0 disables rotation.
+func NewFileSink(path string, maxSize int64, maxBackups int) (Sink, error) {
+	s := &fileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Write appends b and a new line.
+func (s *fileSink) Write(_ context.Context, b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := append(b, '\n')
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		// the records go on to the current file until a rotation succeeds
+		if err := s.rotate(); err != nil {
+			logging.For("audit").Error().Err(err).Str("path", s.path).Msg("unable to rotate the audit file")
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+
+	return err
+}
+
+// Close closes the file.
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = fi.Size()
+
+	return nil
+}
+
+// rotate opens the next file, shifts the backups, moves the current file to
+// path.1 and the next one to path. The current file is kept until the next
+// one is open, so that the sink keeps writing when it cannot be.
+func (s *fileSink) rotate() error {
+	next := s.path + ".next"
+
+	f, err := os.OpenFile(next, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := s.shift(); err != nil {
+		f.Close()
+		os.Remove(next)
+		return err
+	}
+
+	if err := os.Rename(next, s.path); err != nil {
+		f.Close()
+		os.Remove(next)
+		return err
+	}
+
+	if err := s.file.Close(); err != nil {
+		logging.For("audit").Warn().Err(err).Str("path", s.path).Msg("unable to close the rotated audit file")
+	}
+
+	s.file = f
+	s.size = 0
+
+	return nil
+}
+
+// shift shifts the backups and moves the current file to path.1, or removes
+// it without backups.
+func (s *fileSink) shift() error {
+	if s.maxBackups < 1 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(s.backup(i), s.backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(s.path, s.backup(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileSink) backup(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
@@ -0,0 +1,35 @@
+package audit
+
+import "context"
+
+// Publisher publishes data.
+type Publisher interface {
+	Publish(context.Context, []byte) error
+}
+
+// kafkaSink publishes records to a dedicated topic.
+type kafkaSink struct {
+	publisher Publisher
+	close     func() error
+}
+
+// NewKafkaSink creates a sink publishing records with p. close is called by
+// Close and may be nil.
+func NewKafkaSink(p Publisher, close func() error) Sink {
+	return &kafkaSink{
+		publisher: p,
+		close:     close,
+	}
+}
+
+func (s *kafkaSink) Write(ctx context.Context, b []byte) error {
+	return s.publisher.Publish(ctx, b)
+}
+
+func (s *kafkaSink) Close() error {
+	if s.close == nil {
+		return nil
+	}
+
+	return s.close()
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/vladimir-klymniuk/notification-service-original/config"
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/keyring"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/message"
+	"github.com/vladimir-klymniuk/notification-service-original/notify"
+	"github.com/vladimir-klymniuk/notification-service-original/producer"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+	"github.com/vladimir-klymniuk/notification-service-original/requestlog"
+	"github.com/vladimir-klymniuk/notification-service-original/tracing"
+)
+
+// errUnknownService is raised when no service matches the --service and
+// --tenant flags.
+var errUnknownService = errors.New("unknown service")
+
+// target is the service the operator commands act on.
+var target struct {
+	tenant  string
+	service string
+}
+
+func serviceFlags() {
+	pflag.StringVarP(&target.service, "service", "s", "", "name of the service")
+	pflag.StringVarP(&target.tenant, "tenant", "t", "", "tenant of the service, required when several services have the name")
+}
+
+var sendOptions struct {
+	vars map[string]string
+}
+
+func sendFlags() {
+	serviceFlags()
+	pflag.StringToStringVar(&sendOptions.vars, "var", nil, "variable of the url template of the service, e.g. --var order=1")
+}
+
+var tailOptions struct {
+	since time.Duration
+}
+
+func tailFlags() {
+	serviceFlags()
+	pflag.DurationVar(&tailOptions.since, "since", 0, "print the failures of this last period first, e.g. 1h")
+}
+
+var replayOptions struct {
+	since  time.Duration
+	until  time.Duration
+	ids    []string
+	all    bool
+	idle   time.Duration
+	dryRun bool
+}
+
+func replayFlags() {
+	serviceFlags()
+	pflag.DurationVar(&replayOptions.since, "since", 0, "replay the notifications accepted during this last period, e.g. 1h")
+	pflag.DurationVar(&replayOptions.until, "until", 0, "replay only the notifications accepted before this long ago")
+	pflag.StringSliceVar(&replayOptions.ids, "id", nil, "replay only these notification IDs")
+	pflag.BoolVar(&replayOptions.all, "all", false, "replay the notifications without a failure in the error topic too, e.g. delivered ones")
+	pflag.DurationVar(&replayOptions.idle, "idle", 10*time.Second, "stop reading a partition when no record arrives for this long")
+	pflag.BoolVar(&replayOptions.dryRun, "dry-run", false, "print the notifications without publishing them")
+}
+
+// tool holds what the operator commands share.
+type tool struct {
+	cfg      *config.Configuration
+	sconfig  *sarama.Config
+	service  config.ServiceConfig
+	keyring  *keyring.Keyring
+	redactor *redact.Redactor
+}
+
+// newTool reads the configuration and finds the target service.
+func newTool() (*tool, error) {
+	cfg, err := config.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = logging.Setup(cfg.Log.Logging()); err != nil {
+		return nil, err
+	}
+
+	// logs go to stderr, the output of the commands to stdout
+	logging.SetOutput(os.Stderr)
+
+	service, err := findService(cfg.Services, target.tenant, target.service)
+	if err != nil {
+		return nil, err
+	}
+
+	sconfig, err := newSaramaConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kr, err := openKeyring(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "keyring")
+	}
+
+	// propagates the request IDs in the record headers
+	if _, err = tracing.Setup(context.Background(), tracing.Config{ServiceName: appName}); err != nil {
+		return nil, err
+	}
+
+	return &tool{
+		cfg:      cfg,
+		sconfig:  sconfig,
+		service:  service,
+		keyring:  kr,
+		redactor: serviceRedactor(redact.New(cfg.Redact.QueryParams, cfg.Redact.Headers), service),
+	}, nil
+}
+
+// findService returns the service named name, of tenant when it is set.
+func findService(services []config.ServiceConfig, tenant, name string) (config.ServiceConfig, error) {
+	if name == "" {
+		return config.ServiceConfig{}, errors.New("--service is required")
+	}
+
+	var found []config.ServiceConfig
+	for _, s := range services {
+		if s.Name == name && (tenant == "" || s.TenantID == tenant) {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		if tenant != "" {
+			name = tenant + "/" + name
+		}
+
+		return config.ServiceConfig{}, errors.Wrap(errUnknownService, name)
+	case 1:
+		return found[0], nil
+	default:
+		return config.ServiceConfig{}, errors.Errorf("several services are named %s, set --tenant", name)
+	}
+}
+
+// publisher returns a publisher to topic, and the result of its records.
+func (t *tool) publisher(topic string) (producer.Publisher, *publishResult, error) {
+	result := &publishResult{}
+
+	p, err := producer.NewPublisher("", topic, t.cfg.Kafka.Brokers, t.sconfig,
+		producer.WithRedactor(t.redactor),
+		producer.WithObserver(result),
+	)
+
+	return p, result, err
+}
+
+// publishResult is an Observer of a publisher, waiting for the records sent
+// to be acknowledged or to fail.
+type publishResult struct {
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	failed int
+}
+
+func (r *publishResult) Sent(string) {
+	r.wg.Add(1)
+}
+
+func (r *publishResult) Acknowledged(string, time.Duration) {
+	r.wg.Done()
+}
+
+func (r *publishResult) Failed(string, time.Duration) {
+	r.mu.Lock()
+	r.failed++
+	r.mu.Unlock()
+
+	r.wg.Done()
+}
+
+// Wait waits for the records sent, and returns the number of failed ones.
+func (r *publishResult) Wait() int {
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.failed
+}
+
+// fail prints the error of cmd, and returns the exit code of failures.
+func fail(cmd string, err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+
+	return 1
+}
+
+// interruptContext returns a context cancelled on SIGINT or SIGTERM.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
+// send publishes a notification for each url, or path of the destination of
+// the service, to the topic of the service, as /notify does, and prints their
+// IDs.
+func send(args []string) int {
+	requests := sendRequests(args, sendOptions.vars)
+	if len(requests) == 0 {
+		return fail("send", errors.New("no url"))
+	}
+
+	t, err := newTool()
+	if err != nil {
+		return fail("send", err)
+	}
+
+	d, err := destination.New(t.service.Destination())
+	if err != nil {
+		return fail("send", err)
+	}
+
+	pub, result, err := t.publisher(t.service.Topic)
+	if err != nil {
+		return fail("send", err)
+	}
+
+	svc := notify.NewService(pub, newEncoder(t.cfg, t.keyring, t.service), notify.WithDestination(d))
+
+	failed := 0
+	for _, r := range requests {
+		ctx := requestlog.NewContext(context.Background(), requestlog.NewID())
+
+		shown := shownURL(t.redactor, r.HTTPRequest, r.Path)
+
+		id, err := svc.Send(ctx, r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "send: %s: %v\n", shown, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s\t%s\n", id, shown)
+	}
+
+	failed += result.Wait()
+	pub.Close()
+
+	if failed > 0 {
+		return fail("send", errors.Errorf("%d notifications not published", failed))
+	}
+
+	return 0
+}
+
+// shownURL returns the redacted http_request of a notification, or its path
+// when its URL is built from the destination of the service.
+func shownURL(r *redact.Redactor, httpRequest, path string) string {
+	if httpRequest == "" {
+		return path
+	}
+
+	return r.URL(httpRequest)
+}
+
+// sendRequests returns the notifications of the arguments of send: absolute
+// URLs are sent as is, the other arguments are paths of the destination of
+// the service. vars are sent with each of them, or alone without arguments.
+func sendRequests(args []string, vars map[string]string) []notify.Request {
+	if len(args) == 0 && len(vars) > 0 {
+		return []notify.Request{{Type: message.TypeHTTPGet, Variables: vars}}
+	}
+
+	requests := make([]notify.Request, 0, len(args))
+
+	for _, arg := range args {
+		r := notify.Request{Type: message.TypeHTTPGet, Variables: vars}
+
+		if u, err := url.ParseRequestURI(arg); err == nil && u.Host != "" {
+			r.HTTPRequest = arg
+			r.Variables = nil
+		} else {
+			r.Path = arg
+		}
+
+		requests = append(requests, r)
+	}
+
+	return requests
+}
+
+// tailErrors prints the records of the error topic of the service until
+// interrupted.
+func tailErrors([]string) int {
+	t, err := newTool()
+	if err != nil {
+		return fail("tail-errors", err)
+	}
+
+	client, err := sarama.NewClient(t.cfg.Kafka.Brokers, t.sconfig)
+	if err != nil {
+		return fail("tail-errors", err)
+	}
+	defer client.Close()
+
+	var start time.Time
+	if tailOptions.since > 0 {
+		start = time.Now().Add(-tailOptions.since)
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	err = consumeTopic(ctx, client, t.service.Error, start, true, 0, func(m *sarama.ConsumerMessage) {
+		fmt.Println(formatFailure(m))
+	})
+	if err != nil {
+		return fail("tail-errors", err)
+	}
+
+	return 0
+}
+
+// formatFailure returns a record of an error topic on one line: its time,
+// partition and offset, request ID, and the failure.
+func formatFailure(m *sarama.ConsumerMessage) string {
+	line := fmt.Sprintf("%s %d/%d", m.Timestamp.UTC().Format(time.RFC3339), m.Partition, m.Offset)
+
+	if id := requestID(m); id != "" {
+		line += " request_id=" + id
+	}
+
+	return line + " " + strings.TrimSpace(string(m.Value))
+}
+
+// requestID returns the request ID in the headers of a record, which the
+// failures of a notification share with it.
+func requestID(m *sarama.ConsumerMessage) string {
+	return tracing.ConsumerCarrier(m.Headers).Get(requestlog.Header)
+}
+
+// failedRequests returns the request IDs of the records of the error topic
+// since from.
+func failedRequests(ctx context.Context, client sarama.Client, topic string, from time.Time, idle time.Duration) (map[string]bool, error) {
+	failed := make(map[string]bool)
+
+	err := consumeTopic(ctx, client, topic, from, false, idle, func(m *sarama.ConsumerMessage) {
+		if id := requestID(m); id != "" {
+			failed[id] = true
+		}
+	})
+
+	return failed, err
+}
+
+// replay publishes again to the topic of the service the notifications it
+// received during the period given by the flags, so that they are delivered
+// again. Unless --all is set, only the ones with a failure in the error topic
+// are, as the others were delivered or are not processed yet.
+func replay([]string) int {
+	if replayOptions.since <= 0 {
+		return fail("replay", errors.New("--since is required"))
+	}
+
+	now := time.Now()
+	from := now.Add(-replayOptions.since)
+
+	var until time.Time
+	if replayOptions.until > 0 {
+		until = now.Add(-replayOptions.until)
+	}
+
+	t, err := newTool()
+	if err != nil {
+		return fail("replay", err)
+	}
+
+	client, err := sarama.NewClient(t.cfg.Kafka.Brokers, t.sconfig)
+	if err != nil {
+		return fail("replay", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var failures map[string]bool
+	if !replayOptions.all {
+		if failures, err = failedRequests(ctx, client, t.service.Error, from, replayOptions.idle); err != nil {
+			return fail("replay", err)
+		}
+	}
+
+	var pub producer.Publisher
+	result := &publishResult{}
+	if !replayOptions.dryRun {
+		if pub, result, err = t.publisher(t.service.Topic); err != nil {
+			return fail("replay", err)
+		}
+	}
+
+	ids := make(map[string]bool, len(replayOptions.ids))
+	for _, id := range replayOptions.ids {
+		ids[id] = true
+	}
+
+	decoder := newDecoder(t.keyring)
+	encoder := newEncoder(t.cfg, t.keyring, t.service)
+	seen := make(map[string]bool)
+	failed, skipped := 0, 0
+
+	err = consumeTopic(ctx, client, t.service.Topic, from, false, replayOptions.idle, func(r *sarama.ConsumerMessage) {
+		m, err := decoder.Decode(ctx, r.Value)
+		if err != nil {
+			logging.For("replay").Warn().Err(err).Int32("partition", r.Partition).Int64("offset", r.Offset).Msg("unable to decode message")
+			return
+		}
+
+		accepted := m.AcceptedAt
+		if accepted.IsZero() {
+			accepted = r.Timestamp
+		}
+
+		if accepted.Before(from) || (!until.IsZero() && !accepted.Before(until)) {
+			return
+		}
+
+		if (len(ids) > 0 && !ids[m.ID]) || seen[m.ID] {
+			return
+		}
+		seen[m.ID] = true
+
+		if failures != nil && !failures[requestID(r)] {
+			skipped++
+			return
+		}
+
+		fmt.Printf("%s\t%s\n", m.ID, shownURL(t.redactor, m.HTTPRequest, m.Path))
+
+		if pub == nil {
+			return
+		}
+
+		// the record keeps the request ID of the original one
+		rctx := tracing.Extract(context.Background(), tracing.ConsumerCarrier(r.Headers))
+
+		b, err := encoder.Encode(rctx, m)
+		if err == nil {
+			err = pub.Publish(rctx, b)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: %s: %v\n", m.ID, err)
+			failed++
+		}
+	})
+
+	if pub != nil {
+		failed += result.Wait()
+		pub.Close()
+	}
+
+	if err != nil {
+		return fail("replay", err)
+	}
+
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "replay: %d notifications without failure skipped, --all replays them\n", skipped)
+	}
+
+	if failed > 0 {
+		return fail("replay", errors.Errorf("%d notifications not published", failed))
+	}
+
+	return 0
+}
+
+// consumeTopic calls fn with the records of topic, from the offsets at start
+// or from the newest ones when start is zero. With follow it runs until ctx
+// is done, otherwise it stops after the records present when it is called,
+// or after idle without a record: the last offsets of a partition may hold
+// no record, when compacted or used by transaction markers.
+func consumeTopic(ctx context.Context, client sarama.Client, topic string, start time.Time, follow bool, idle time.Duration, fn func(*sarama.ConsumerMessage)) error {
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	records := make(chan *sarama.ConsumerMessage)
+	var wg sync.WaitGroup
+
+	for _, p := range partitions {
+		offset := sarama.OffsetNewest
+		if !start.IsZero() {
+			// the newest offset when no record is that recent
+			if offset, err = client.GetOffset(topic, p, start.UnixNano()/int64(time.Millisecond)); err != nil {
+				break
+			}
+		}
+
+		end := int64(-1)
+		if !follow {
+			if end, err = client.GetOffset(topic, p, sarama.OffsetNewest); err != nil {
+				break
+			}
+
+			if offset == sarama.OffsetNewest || offset >= end {
+				continue
+			}
+		}
+
+		var pc sarama.PartitionConsumer
+		if pc, err = consumer.ConsumePartition(topic, p, offset); err != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(p int32, pc sarama.PartitionConsumer, end int64) {
+			defer wg.Done()
+			defer pc.Close()
+
+			for {
+				// nil, never ready, when following
+				var timeout <-chan time.Time
+				if !follow && idle > 0 {
+					timeout = time.After(idle)
+				}
+
+				select {
+				case m := <-pc.Messages():
+					select {
+					case records <- m:
+					case <-ctx.Done():
+						return
+					}
+
+					if !follow && m.Offset >= end-1 {
+						return
+					}
+				case <-timeout:
+					logging.For("consumer").Warn().Str("topic", topic).Int32("partition", p).Int64("end", end).
+						Msgf("no record for %s, partition stopped before its end", idle)
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(p, pc, end)
+	}
+
+	if err != nil {
+		cancel()
+		wg.Wait()
+
+		return err
+	}
+
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+
+	for m := range records {
+		fn(m)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vladimir-klymniuk/notification-service-original/config"
+	"github.com/vladimir-klymniuk/notification-service-original/notify"
+)
+
+func Test_findService(t *testing.T) {
+	services := []config.ServiceConfig{
+		{Name: "ssp", TenantID: "delivery"},
+		{Name: "dsp", TenantID: "delivery"},
+		{Name: "dsp", TenantID: "billing"},
+	}
+
+	s, err := findService(services, "", "ssp")
+	assert.NoError(t, err)
+	assert.Equal(t, "delivery", s.TenantID)
+
+	s, err = findService(services, "billing", "dsp")
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", s.TenantID)
+
+	_, err = findService(services, "", "dsp")
+	assert.EqualError(t, err, "several services are named dsp, set --tenant")
+
+	_, err = findService(services, "billing", "ssp")
+	assert.Equal(t, errUnknownService, errors.Cause(err))
+	assert.EqualError(t, err, "billing/ssp: unknown service")
+
+	_, err = findService(services, "", "")
+	assert.Error(t, err)
+}
+
+func Test_formatFailure(t *testing.T) {
+	m := &sarama.ConsumerMessage{
+		Timestamp: time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC),
+		Partition: 2,
+		Offset:    42,
+		Headers:   []*sarama.RecordHeader{{Key: []byte("X-Request-ID"), Value: []byte("abc")}},
+		Value:     []byte("request: http://a.com/x : attempt: 3 : timeout\n"),
+	}
+
+	assert.Equal(t, "2020-07-01T10:00:00Z 2/42 request_id=abc request: http://a.com/x : attempt: 3 : timeout", formatFailure(m))
+
+	m.Headers = nil
+	assert.Equal(t, "2020-07-01T10:00:00Z 2/42 request: http://a.com/x : attempt: 3 : timeout", formatFailure(m))
+}
+
+// newTopicBroker returns a broker of topic with one partition, whose records
+// are values from offset 0, and whose high-water mark is end.
+func newTopicBroker(t *testing.T, topic string, start time.Time, end int64, values ...string) (*sarama.MockBroker, sarama.Client) {
+	broker := sarama.NewMockBroker(t, 1)
+
+	fetch := sarama.NewMockFetchResponse(t, len(values)).SetHighWaterMark(topic, 0, end)
+	for i, v := range values {
+		fetch.SetMessage(topic, 0, int64(i), sarama.StringEncoder(v))
+	}
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset(topic, 0, start.UnixNano()/int64(time.Millisecond), 0).
+			SetOffset(topic, 0, sarama.OffsetOldest, 0).
+			SetOffset(topic, 0, sarama.OffsetNewest, end),
+		"FetchRequest": fetch,
+	})
+
+	client, err := sarama.NewClient([]string{broker.Addr()}, sarama.NewConfig())
+	require.NoError(t, err)
+
+	return broker, client
+}
+
+func Test_consumeTopic_Stops_When_Idle(t *testing.T) {
+	start := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	// the last offset holds no record, e.g. a transaction marker
+	broker, client := newTopicBroker(t, "ssp", start, 3, "a", "b")
+	defer broker.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var values []string
+	err := consumeTopic(ctx, client, "ssp", start, false, 100*time.Millisecond, func(m *sarama.ConsumerMessage) {
+		values = append(values, string(m.Value))
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, ctx.Err(), "stopped by the idle cutoff")
+	assert.Equal(t, []string{"a", "b"}, values)
+}
+
+func Test_requestID(t *testing.T) {
+	m := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{{Key: []byte("X-Request-ID"), Value: []byte("abc")}}}
+	assert.Equal(t, "abc", requestID(m))
+
+	assert.Equal(t, "", requestID(&sarama.ConsumerMessage{}))
+}
+
+func Test_findCommand(t *testing.T) {
+	c, ok := findCommand("tail-errors")
+	assert.True(t, ok)
+	assert.Equal(t, "tail-errors", c.name)
+
+	_, ok = findCommand("tail")
+	assert.False(t, ok)
+}
+
+func Test_commandName(t *testing.T) {
+	tests := []struct {
+		args   []string
+		name   string
+		exists bool
+	}{
+		{args: nil},
+		{args: []string{"-c", "conf.d"}},
+		{args: []string{"send", "-s", "ssp"}, name: "send", exists: true},
+		{args: []string{"-c", "conf.d", "send", "-s", "ssp"}, name: "send", exists: true},
+		{args: []string{"sned", "-s", "ssp"}, name: "sned", exists: true},
+		{args: []string{"-c", "conf.d", "--", "send"}},
+	}
+
+	for _, tt := range tests {
+		name, ok := commandName(tt.args)
+		assert.Equal(t, tt.name, name, tt.args)
+		assert.Equal(t, tt.exists, ok, tt.args)
+	}
+}
+
+func Test_sendRequests(t *testing.T) {
+	vars := map[string]string{"order": "1"}
+
+	assert.Equal(t, []notify.Request{
+		{Type: "httpget", HTTPRequest: "https://example.com/cb"},
+		{Type: "httpget", Path: "/orders/1", Variables: vars},
+	}, sendRequests([]string{"https://example.com/cb", "/orders/1"}, vars))
+
+	assert.Equal(t, []notify.Request{{Type: "httpget", Variables: vars}}, sendRequests(nil, vars))
+	assert.Empty(t, sendRequests(nil, nil))
+}
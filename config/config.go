@@ -10,45 +10,163 @@ package config
 
 import (
 	"flag"
-	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/httpclient"
+	"github.com/vladimir-klymniuk/notification-service-original/kafka"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
 )
 
 // Configuration is top-level and represents all configuration settings
 type Configuration struct {
 	// Application
 	App AppConfig
+	// Admin
+	Admin AdminConfig
 	// Log
 	Log LogConfig
 	// Service
 	// Service ServiceConfig
 	//
 	Services []ServiceConfig
+	// Topics
+	Topics TopicsConfig
 	// Kafka
 	Kafka KafkaConfig
+	// Redact
+	Redact RedactConfig
+	// Encryption
+	Encryption EncryptionConfig
+	// Audit
+	Audit AuditConfig
+	// Tracing
+	Tracing TracingConfig
+	// Metrics
+	Metrics MetricsConfig
+
+	// values and their sources, set by load
+	settings []Setting
 }
 
 // AppConfig represents the application config
 type AppConfig struct {
 	// Port for http server
 	Port int `mapstructure:"Port"`
-	// Enable pprof
+	// Enable pprof on the admin server
 	EnablePprof bool `mapstructure:"EnablePprof"`
+	// Time after which a readiness check fails
+	ReadinessTimeout time.Duration `mapstructure:"ReadinessTimeout"`
+	// Time given to the tasks in flight of a stopped service to complete
+	DrainTimeout time.Duration `mapstructure:"DrainTimeout"`
+	// Time during which a record which could not be written fails the
+	// readiness of the producer, unless a later one is written
+	ProducerFailureWindow time.Duration `mapstructure:"ProducerFailureWindow"`
+}
+
+// AdminConfig represents the admin server config
+type AdminConfig struct {
+	// Interface the admin server listens on
+	Host string `mapstructure:"Host"`
+	// Port for the admin server, 0 disables it
+	Port int `mapstructure:"Port"`
+	// Token required on every admin request
+	Token Secret `mapstructure:"Token"`
 }
 
 type KafkaConfig struct {
 	UseCredentials bool     `mapstructure:"UseCredentials"`
 	Username       string   `mapstructure:"Username"`
-	Password       string   `mapstructure:"Password"`
+	Password       Secret   `mapstructure:"Password"`
 	Brokers        []string `mapstructure:"Brokers"`
+	// Version of the brokers, "2.4.0" by default
+	Version string `mapstructure:"Version"`
+	// Client ID sent to the brokers, notification-service-<hostname> by default.
+	// It must be unique per instance for the partitions assigned to it to be reported
+	ClientID string `mapstructure:"ClientID"`
+	// Period of the refresh of the cluster metadata, 10m by default
+	MetadataRefresh time.Duration `mapstructure:"MetadataRefresh"`
+	// Consumer groups of the services
+	Consumer KafkaConsumerConfig `mapstructure:"Consumer"`
+	// Producers of the notifications, failures and audit records
+	Producer KafkaProducerConfig `mapstructure:"Producer"`
+}
+
+// KafkaConsumerConfig represents the tuning of the consumer groups
+type KafkaConsumerConfig struct {
+	// Offset of a group without committed offsets: "newest" (default) or "oldest"
+	InitialOffset string `mapstructure:"InitialOffset"`
+	// Partition assignment: "range" (default), "roundrobin" or "sticky"
+	RebalanceStrategy string        `mapstructure:"RebalanceStrategy"`
+	SessionTimeout    time.Duration `mapstructure:"SessionTimeout"`
+	HeartbeatInterval time.Duration `mapstructure:"HeartbeatInterval"`
+	CommitInterval    time.Duration `mapstructure:"CommitInterval"`
+	// Fetch sizes in bytes, FetchMax 0 is unlimited
+	FetchMin     int32 `mapstructure:"FetchMin"`
+	FetchDefault int32 `mapstructure:"FetchDefault"`
+	FetchMax     int32 `mapstructure:"FetchMax"`
+}
+
+// KafkaProducerConfig represents the tuning of the producers
+type KafkaProducerConfig struct {
+	// Acknowledgements awaited: "none", "local" (default) or "all"
+	RequiredAcks string `mapstructure:"RequiredAcks"`
+	// "none", "gzip", "snappy", "lz4" or "zstd", snappy with credentials and none otherwise by default
+	Compression string `mapstructure:"Compression"`
+	// Batching, records are sent at once by default
+	FlushFrequency  time.Duration `mapstructure:"FlushFrequency"`
+	FlushBytes      int           `mapstructure:"FlushBytes"`
+	FlushMessages   int           `mapstructure:"FlushMessages"`
+	MaxMessageBytes int           `mapstructure:"MaxMessageBytes"`
+}
+
+// Client returns the configuration of the kafka clients.
+func (c KafkaConfig) Client() kafka.ClientConfig {
+	cc := kafka.ClientConfig{
+		Version:         c.Version,
+		ClientID:        c.ClientID,
+		MetadataRefresh: c.MetadataRefresh,
+		Consumer: kafka.ConsumerConfig{
+			InitialOffset:     c.Consumer.InitialOffset,
+			RebalanceStrategy: c.Consumer.RebalanceStrategy,
+			SessionTimeout:    c.Consumer.SessionTimeout,
+			HeartbeatInterval: c.Consumer.HeartbeatInterval,
+			CommitInterval:    c.Consumer.CommitInterval,
+			FetchMin:          c.Consumer.FetchMin,
+			FetchDefault:      c.Consumer.FetchDefault,
+			FetchMax:          c.Consumer.FetchMax,
+		},
+		Producer: kafka.ProducerConfig{
+			RequiredAcks:    c.Producer.RequiredAcks,
+			Compression:     c.Producer.Compression,
+			FlushFrequency:  c.Producer.FlushFrequency,
+			FlushBytes:      c.Producer.FlushBytes,
+			FlushMessages:   c.Producer.FlushMessages,
+			MaxMessageBytes: c.Producer.MaxMessageBytes,
+		},
+	}
+
+	if c.UseCredentials {
+		cc.Username = c.Username
+		cc.Password = c.Password.Value
+
+		if cc.Producer.Compression == "" {
+			cc.Producer.Compression = "snappy"
+		}
+	}
+
+	return cc
 }
 
 type ServiceConfig struct {
@@ -59,18 +177,204 @@ type ServiceConfig struct {
 	RetryDelay  time.Duration `mapstructure:"RetryDelay"`
 	Timeout     time.Duration `mapstructure:"Timeout"`
 	GroupID     string        `mapstructure:"GroupID"`
-	Topic       string        `mapstructure:"Topic"`
-	Error       string        `mapstructure:"Error"`
+	// Topic of the notifications, given by Topics.Template when empty
+	Topic string `mapstructure:"Topic"`
+	// Topic of the failed notifications, given by Topics.ErrorTemplate when empty
+	Error string `mapstructure:"Error"`
+	// Client sending the notifications
+	HTTP HTTPClientConfig `mapstructure:"HTTP"`
+	// URL the path of the notifications is appended to
+	BaseURL string `mapstructure:"BaseURL"`
+	// text/template of the URL of the notifications, executed with .BaseURL,
+	// .Path and .Variables, e.g. "{{.BaseURL}}/orders/{{.Variables.order}}"
+	URLTemplate string `mapstructure:"URLTemplate"`
+	// Query parameters added to the URLs of the destination without them
+	Query map[string]Secret `mapstructure:"Query"`
+	// Headers set on the requests to the destination
+	Headers map[string]Secret `mapstructure:"Headers"`
+}
+
+// HTTPClientConfig represents the client sending the notifications of a
+// service, zero values keep the defaults
+type HTTPClientConfig struct {
+	// Connection timeout, 1s by default
+	DialTimeout time.Duration `mapstructure:"DialTimeout"`
+	// TLS handshake timeout, 5s by default
+	TLSHandshakeTimeout time.Duration `mapstructure:"TLSHandshakeTimeout"`
+	// Time to wait for the response headers once the request is written, none by default
+	ResponseHeaderTimeout time.Duration `mapstructure:"ResponseHeaderTimeout"`
+	// Keep-alive period of the TCP connections, 15s by default, negative disables it
+	KeepAlive time.Duration `mapstructure:"KeepAlive"`
+	// Open a connection per request
+	DisableKeepAlives bool `mapstructure:"DisableKeepAlives"`
+	// Time after which an idle connection is closed, none by default
+	IdleConnTimeout time.Duration `mapstructure:"IdleConnTimeout"`
+	// Idle connections kept, 50000 by default
+	MaxIdleConns int `mapstructure:"MaxIdleConns"`
+	// Idle connections kept per host, 50000 by default
+	MaxIdleConnsPerHost int `mapstructure:"MaxIdleConnsPerHost"`
+	// Connections per host, unlimited by default
+	MaxConnsPerHost int `mapstructure:"MaxConnsPerHost"`
+	// Path of the PEM certificates trusted instead of the system ones
+	CABundle string `mapstructure:"CABundle"`
+	// Paths of the PEM client certificate and key
+	ClientCert string `mapstructure:"ClientCert"`
+	ClientKey  string `mapstructure:"ClientKey"`
+	// URL of the proxy the requests are sent through
+	ProxyURL string `mapstructure:"ProxyURL"`
+	// Attempt HTTP/2 with the destinations supporting it
+	HTTP2 bool `mapstructure:"HTTP2"`
+	// Redirects: "follow" (default), "none" or "same-host"
+	RedirectPolicy string `mapstructure:"RedirectPolicy"`
+	// User-Agent of the requests
+	UserAgent string `mapstructure:"UserAgent"`
+	// Refuse to connect to loopback, private and link-local addresses
+	BlockPrivateNetworks bool `mapstructure:"BlockPrivateNetworks"`
+}
+
+// Client returns the configuration of the client of the service.
+func (c ServiceConfig) Client() httpclient.Config {
+	h := c.HTTP
+
+	return httpclient.Config{
+		Timeout:               c.Timeout,
+		DialTimeout:           h.DialTimeout,
+		TLSHandshakeTimeout:   h.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: h.ResponseHeaderTimeout,
+		KeepAlive:             h.KeepAlive,
+		DisableKeepAlives:     h.DisableKeepAlives,
+		IdleConnTimeout:       h.IdleConnTimeout,
+		MaxIdleConns:          h.MaxIdleConns,
+		MaxIdleConnsPerHost:   h.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       h.MaxConnsPerHost,
+		CABundle:              h.CABundle,
+		ClientCert:            h.ClientCert,
+		ClientKey:             h.ClientKey,
+		ProxyURL:              h.ProxyURL,
+		HTTP2:                 h.HTTP2,
+		RedirectPolicy:        h.RedirectPolicy,
+		UserAgent:             h.UserAgent,
+		BlockPrivateNetworks:  h.BlockPrivateNetworks,
+	}
+}
+
+// Destination returns the configuration of the destination of the
+// notifications of the service.
+func (c ServiceConfig) Destination() destination.Config {
+	return destination.Config{
+		BaseURL:  c.BaseURL,
+		Template: c.URLTemplate,
+		Query:    secretFuncs(c.Query),
+		Headers:  secretFuncs(c.Headers),
+	}
+}
+
+// secretFuncs returns the functions resolving secrets, by name.
+func secretFuncs(secrets map[string]Secret) map[string]func() (string, error) {
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	funcs := make(map[string]func() (string, error), len(secrets))
+	for name, secret := range secrets {
+		funcs[name] = secret.Value
+	}
+
+	return funcs
+}
+
+// TopicsConfig represents the naming of the topics of the services without
+// explicit names. Templates are text/template applied to the ServiceConfig,
+// e.g. "{{.TenantID}}-{{.Name}}"
+type TopicsConfig struct {
+	// Template of the topic of the notifications
+	Template string `mapstructure:"Template"`
+	// Template of the topic of the failed notifications
+	ErrorTemplate string `mapstructure:"ErrorTemplate"`
+}
+
+// RedactConfig lists the values masked in logs and error topics
+type RedactConfig struct {
+	// Query parameter names whose values are masked in URLs
+	QueryParams []string `mapstructure:"QueryParams"`
+	// Header names whose values are masked
+	Headers []string `mapstructure:"Headers"`
+}
+
+// EncryptionConfig represents the encryption of messages stored in kafka
+type EncryptionConfig struct {
+	// Encrypt new messages with the tenant key
+	Enabled bool `mapstructure:"Enabled"`
+	// Path of the keyring file
+	Keyring string `mapstructure:"Keyring"`
+}
+
+// AuditConfig represents the audit log configuration
+type AuditConfig struct {
+	// Sink of the audit records: "file", "kafka", or empty to disable auditing
+	Sink string `mapstructure:"Sink"`
+	// Path of the JSONL file, for the file sink
+	Path string `mapstructure:"Path"`
+	// Size in megabytes after which the file is rotated, 0 disables rotation
+	MaxSizeMB int `mapstructure:"MaxSizeMB"`
+	// Number of rotated files kept
+	MaxBackups int `mapstructure:"MaxBackups"`
+	// Topic of the audit records, for the kafka sink
+	Topic string `mapstructure:"Topic"`
+}
+
+// TracingConfig represents the export of the traces
+type TracingConfig struct {
+	// Exporter of the spans: "otlp", "stdout", "file", or empty to only propagate trace context
+	Exporter string `mapstructure:"Exporter"`
+	// host:port of the OTLP/HTTP collector
+	Endpoint string `mapstructure:"Endpoint"`
+	// Disable TLS towards the collector
+	Insecure bool `mapstructure:"Insecure"`
+	// Path of the file spans are written to, for the file exporter
+	Path string `mapstructure:"Path"`
+	// Fraction of new traces recorded, between 0 and 1
+	SampleRatio float64 `mapstructure:"SampleRatio"`
+}
+
+// MetricsConfig represents the metrics configuration
+type MetricsConfig struct {
+	// Number of destination hosts reported individually per service, the others are reported as "other"
+	MaxHosts int `mapstructure:"MaxHosts"`
+	// Interval between refreshes of the consumer offsets and lag, 0 disables them
+	ConsumerLagInterval time.Duration `mapstructure:"ConsumerLagInterval"`
 }
 
 // LogConfig represents the log configuration
 type LogConfig struct {
-	// Log level
-	Level int `mapstructure:"Level"`
-	// Verbose mode will allow to append logging middlewares
+	// Log level: debug, info, warn or error
+	Level string `mapstructure:"Level"`
+	// Format of the logs: json or console
+	Format string `mapstructure:"Format"`
+	// Level by package name, overriding Level
+	Packages map[string]string `mapstructure:"Packages"`
+	// Log 1 of every SampleEvery per-message info logs, 0 logs them all
+	SampleEvery uint32 `mapstructure:"SampleEvery"`
+	// Verbose logs each request handled by /notify
 	Verbose bool `mapstructure:"Verbose"`
 }
 
+// Logging returns the configuration of the loggers.
+func (c LogConfig) Logging() logging.Config {
+	return logging.Config{
+		Level:       c.Level,
+		Format:      c.Format,
+		Packages:    c.Packages,
+		SampleEvery: c.SampleEvery,
+	}
+}
+
+// Audit sinks
+const (
+	AuditSinkFile  = "file"
+	AuditSinkKafka = "kafka"
+)
+
 var config *Configuration
 var once sync.Once
 
@@ -89,7 +393,48 @@ func GetConfig() *Configuration {
 }
 
 func setup() {
-	config = &Configuration{}
+	bind()
+
+	err := readConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("error when reading the config file")
+	}
+
+	c, err := load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("load config")
+		return
+	}
+
+	config = c
+}
+
+// Check reads and validates the configuration as GetConfig does, but returns
+// the problems found instead of exiting.
+func Check() (*Configuration, error) {
+	bind()
+
+	// the configuration can come from the environment only
+	if err := readConfig(); err != nil && !isNotFound(err) {
+		return nil, errors.Wrap(err, "read config")
+	}
+
+	return load()
+}
+
+// ParseFlags parses the command line, with the flags registered on
+// pflag.CommandLine by the caller, and returns the arguments left.
+func ParseFlags() []string {
+	once2.Do(func() {
+		bindFlag()
+	})
+
+	return pflag.Args()
+}
+
+// bind sets where the configuration is read from.
+func bind() {
+	bindDefaults()
 
 	bindEnv()
 
@@ -99,43 +444,56 @@ func setup() {
 	})
 
 	bindFile()
+}
 
-	err := viper.ReadInConfig()
-	if err != nil {
-		log.Error().Err(err).Msg("error when reading the config file")
+// load decodes and validates the configuration read by viper.
+func load() (*Configuration, error) {
+	c := &Configuration{}
+
+	if err := viper.Unmarshal(c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal config")
 	}
 
-	err = viper.Unmarshal(config)
+	services, fromEnv, err := mergeEnvServices(c.Services, os.Environ())
 	if err != nil {
-		log.Fatal().Err(err).Msg("unmarshal config")
+		return nil, errors.Wrap(err, "services from environment")
 	}
+	c.Services = services
 
-	err = validate()
-	if err != nil {
-		log.Fatal().Err(err).Msg("validate config")
-		return
+	if err := validate(c); err != nil {
+		return nil, errors.Wrap(err, "validate config")
 	}
 
-	setServiceVariables()
-}
+	src := newSources(fromEnv)
+	loaded := append([]ServiceConfig(nil), c.Services...)
 
-func validate() error {
-	for i := range config.Services {
-		service := config.Services[i]
+	setServiceVariables(c)
 
-		if service.Name == "" {
-			return errors.Wrap(ErrRequiredParameter, "name")
-		}
+	c.settings = settings(c, loaded, src)
 
-		if service.TenantID == "" {
-			return errors.Wrap(ErrRequiredParameter, "tenantId")
-		}
+	return c, nil
+}
+
+// Watch calls onChange with the configuration read again whenever the config
+// file, or a file of the config directory, changes, or with the error making
+// it invalid. The configuration returned by GetConfig is not modified.
+func Watch(onChange func(*Configuration, error)) {
+	if dir := configDir(); dir != "" {
+		watchDir(dir, onChange)
+		return
 	}
 
-	return nil
+	viper.OnConfigChange(func(fsnotify.Event) {
+		if f, _, err := readConfigFiles([]string{viper.ConfigFileUsed()}); err == nil {
+			files = f
+		}
+
+		onChange(load())
+	})
+	viper.WatchConfig()
 }
 
-func setServiceVariables() {
+func setServiceVariables(config *Configuration) {
 	for i := range config.Services {
 		service := &config.Services[i]
 
@@ -143,22 +501,71 @@ func setServiceVariables() {
 			service.MaxRequests = 1
 		}
 
-		service.Topic = fmt.Sprintf("%s-%s", service.TenantID, service.Name)
-		service.Error = fmt.Sprintf("%s-%s-error", service.TenantID, service.Name)
+		// validated before
+		service.Topic, service.Error, _ = topicNames(config.Topics, *service)
+	}
+}
+
+func bindDefaults() {
+	viper.SetDefault("App.ReadinessTimeout", 2*time.Second)
+	viper.SetDefault("App.DrainTimeout", 30*time.Second)
+	viper.SetDefault("App.ProducerFailureWindow", time.Minute)
+	viper.SetDefault("Kafka.Version", "2.4.0")
+	viper.SetDefault("Kafka.Consumer.CommitInterval", time.Second)
+	viper.SetDefault("Topics.Template", DefaultTopicTemplate)
+	viper.SetDefault("Topics.ErrorTemplate", DefaultErrorTopicTemplate)
+	viper.SetDefault("Log.Level", "debug")
+	viper.SetDefault("Log.Format", logging.FormatJSON)
+	viper.SetDefault("Admin.Host", "127.0.0.1")
+	viper.SetDefault("Admin.Port", 11001)
+	viper.SetDefault("Audit.Path", "/var/log/notification-service/audit.jsonl")
+	viper.SetDefault("Audit.MaxSizeMB", 100)
+	viper.SetDefault("Audit.MaxBackups", 5)
+	viper.SetDefault("Audit.Topic", "notification-service-audit")
+	viper.SetDefault("Tracing.Endpoint", "localhost:4318")
+	viper.SetDefault("Tracing.SampleRatio", 1.0)
+	viper.SetDefault("Metrics.MaxHosts", 100)
+	viper.SetDefault("Metrics.ConsumerLagInterval", 30*time.Second)
+	viper.SetDefault("Redact.QueryParams", redact.DefaultQueryParams)
+	viper.SetDefault("Redact.Headers", redact.DefaultHeaders)
+}
+
+// envNames are the environment variables bound explicitly, the others are
+// NOTIFICATION_SERVICE_<KEY>, e.g. NOTIFICATION_SERVICE_KAFKA.BROKERS.
+var envNames = map[string]string{
+	"log.level":  "NOTIFICATION_SERVICE_LOG_LEVEL",
+	"log.format": "NOTIFICATION_SERVICE_LOG_FORMAT",
+}
+
+// envName returns the environment variable of key.
+func envName(key string) string {
+	if name, ok := envNames[key]; ok {
+		return name
 	}
+
+	return strings.ToUpper("NOTIFICATION_SERVICE_" + key)
 }
 
 func bindEnv() {
 	viper.SetEnvPrefix("NOTIFICATION_SERVICE")
 
-	viper.BindEnv("Log.Level", "NOTIFICATION_SERVICE_LOG_LEVEL")
+	for key, name := range envNames {
+		viper.BindEnv(key, name)
+	}
 
 	viper.AutomaticEnv()
 }
 
 func bindFile() {
 	filePath := viper.GetString("CONFIG_PATH")
-	if _, err := os.Stat(filePath); err == nil {
+
+	fi, err := os.Stat(filePath)
+	if err == nil && fi.IsDir() {
+		// every config file of the directory is read by readConfig
+		return
+	}
+
+	if err == nil {
 		ftype := filepath.Ext(filePath)
 		if len(ftype) > 1 {
 			ftype = ftype[1:]
@@ -179,7 +586,7 @@ func bindFile() {
 
 func bindFlag() {
 	pflag.IntP("APP.PORT", "p", 11000, "port of the api")
-	pflag.StringP("CONFIG_PATH", "c", "/etc/notification-service/conf.d/notification-service.toml", "location of the config file")
+	pflag.StringP("CONFIG_PATH", "c", "/etc/notification-service/conf.d/", "location of the config file, or of the directory whose config files are all read")
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
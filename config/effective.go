@@ -0,0 +1,270 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+)
+
+// Sources of the configuration values
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+	// SourceDerived values are computed from the others, e.g. the topics of the services
+	SourceDerived = "derived"
+)
+
+// Setting is a resolved configuration value and where it came from. Secrets
+// are masked.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	// File setting the value, for SourceFile
+	File string `json:"file,omitempty"`
+}
+
+// Settings returns the values of the configuration and their sources, as
+// they were when it was loaded.
+func (c *Configuration) Settings() []Setting {
+	return c.settings
+}
+
+// Reloaded returns c with the services of next, as applied by a reload: the
+// other settings are only read at startup.
+func (c *Configuration) Reloaded(next *Configuration) *Configuration {
+	r := *c
+	r.Services = next.Services
+	r.settings = nil
+
+	for _, s := range c.settings {
+		if !strings.HasPrefix(s.Key, "services[") {
+			r.settings = append(r.settings, s)
+		}
+	}
+
+	for _, s := range next.settings {
+		if strings.HasPrefix(s.Key, "services[") {
+			r.settings = append(r.settings, s)
+		}
+	}
+
+	return &r
+}
+
+// Handler serves the settings of the configuration returned by current.
+func Handler(current func() *Configuration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Settings []Setting `json:"settings"`
+		}{current().Settings()})
+	}
+}
+
+// sources tells where the values read by viper come from.
+type sources struct {
+	flags map[string]bool
+	files *configFiles
+	// keys of the services set by environment variables, by service index
+	services map[int]map[string]bool
+}
+
+// newSources reads the sources of the values of viper: the flags set, and
+// the config files read.
+func newSources(services map[int]map[string]bool) *sources {
+	s := &sources{flags: make(map[string]bool), files: files, services: services}
+
+	pflag.CommandLine.VisitAll(func(f *pflag.Flag) {
+		s.flags[strings.ToLower(f.Name)] = f.Changed
+	})
+
+	return s
+}
+
+// of returns the source of key, in the order of precedence of viper, and
+// the file setting it.
+func (s *sources) of(key string) (string, string) {
+	if s.flags[key] {
+		return SourceFlag, ""
+	}
+
+	if v, ok := os.LookupEnv(envName(key)); ok && v != "" {
+		return SourceEnv, ""
+	}
+
+	if path := s.files.fileOf(key); path != "" {
+		return SourceFile, path
+	}
+
+	return SourceDefault, ""
+}
+
+// service returns the source of the field key of the i-th service, given
+// whether setServiceVariables changed it, and the file setting it.
+func (s *sources) service(i int, key string, changed bool) (string, string) {
+	for k := range s.services[i] {
+		// the entries of maps, such as headers, are set one by one
+		if k == key || strings.HasPrefix(k, key+".") {
+			return SourceEnv, ""
+		}
+	}
+
+	if path := s.files.serviceFileOf(i, key); path != "" {
+		return SourceFile, path
+	}
+
+	if changed {
+		return SourceDerived, ""
+	}
+
+	return SourceDefault, ""
+}
+
+// lookup reports whether the path of keys exists in m, case-insensitively.
+func lookup(m map[string]interface{}, path []string) bool {
+	for k, v := range m {
+		if !strings.EqualFold(k, path[0]) {
+			continue
+		}
+
+		if len(path) == 1 {
+			return true
+		}
+
+		if sub, ok := v.(map[string]interface{}); ok {
+			return lookup(sub, path[1:])
+		}
+	}
+
+	return false
+}
+
+// settings lists the values of c with their sources. loaded holds the
+// services as decoded, before setServiceVariables.
+func settings(c *Configuration, loaded []ServiceConfig, src *sources) []Setting {
+	r := redact.New(c.Redact.QueryParams, c.Redact.Headers)
+
+	var list []Setting
+
+	walk(reflect.ValueOf(*c), "", func(key string, v reflect.Value) {
+		source, file := src.of(key)
+		list = append(list, Setting{Key: key, Value: display(v, r), Source: source, File: file})
+	})
+
+	for i, service := range c.Services {
+		var before reflect.Value
+		if i < len(loaded) {
+			before = reflect.ValueOf(loaded[i])
+		}
+
+		prefix := "services[" + strconv.Itoa(i) + "]"
+
+		walk(reflect.ValueOf(service), "", func(key string, v reflect.Value) {
+			changed := before.IsValid() && !reflect.DeepEqual(fieldAt(before, key).Interface(), v.Interface())
+
+			source, file := src.service(i, key, changed)
+
+			list = append(list, Setting{
+				Key:    prefix + "." + key,
+				Value:  display(v, r),
+				Source: source,
+				File:   file,
+			})
+		})
+	}
+
+	return list
+}
+
+// walk calls fn with the key and value of each field of the struct v, nested
+// structs excepted. The services are skipped.
+func walk(v reflect.Value, prefix string, fn func(string, reflect.Value)) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Type == reflect.TypeOf([]ServiceConfig(nil)) {
+			continue
+		}
+
+		key := prefix + strings.ToLower(fieldName(f))
+
+		if f.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), key+".", fn)
+			continue
+		}
+
+		fn(key, v.Field(i))
+	}
+}
+
+// fieldAt returns the field of the struct v at the key given by walk.
+func fieldAt(v reflect.Value, key string) reflect.Value {
+	for _, name := range strings.Split(key, ".") {
+		t := v.Type()
+
+		for i := 0; i < t.NumField(); i++ {
+			if strings.ToLower(fieldName(t.Field(i))) == name {
+				v = v.Field(i)
+				break
+			}
+		}
+	}
+
+	return v
+}
+
+// fieldName returns the name of f in the configuration.
+func fieldName(f reflect.StructField) string {
+	if name := f.Tag.Get("mapstructure"); name != "" {
+		return name
+	}
+
+	return f.Name
+}
+
+// display returns v as shown in the settings: secrets masked, URLs redacted
+// and durations readable.
+func display(v reflect.Value, r *redact.Redactor) interface{} {
+	switch x := v.Interface().(type) {
+	case Secret:
+		return x.display()
+	case map[string]Secret:
+		m := make(map[string]string, len(x))
+		for k, secret := range x {
+			m[k] = secret.display()
+		}
+
+		return m
+	case time.Duration:
+		return x.String()
+	case string:
+		return r.Text(x)
+	case []string:
+		s := make([]string, len(x))
+		for i := range x {
+			s[i] = r.Text(x[i])
+		}
+
+		return s
+	default:
+		return x
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// envServicesPrefix starts the environment variables of the services:
+// NOTIFICATION_SERVICE_SERVICES_<index>_<field>, e.g.
+// NOTIFICATION_SERVICE_SERVICES_0_TENANTID or
+// NOTIFICATION_SERVICE_SERVICES_0_HTTP_DIALTIMEOUT.
+const envServicesPrefix = "NOTIFICATION_SERVICE_SERVICES_"
+
+// envMapFields are the fields whose keys are names, such as
+// NOTIFICATION_SERVICE_SERVICES_0_HEADERS_X__API__KEY: the rest of the
+// variable is the name, where "__" stands for "-" and "_" is kept.
+var envMapFields = []string{"HEADERS", "QUERY"}
+
+// envService is a service defined by environment variables.
+type envService struct {
+	index int
+	// keys set, as walk names them, e.g. "http.dialtimeout"
+	keys map[string]bool
+	v    *viper.Viper
+}
+
+// envServices returns the services defined in environ, by index.
+func envServices(environ []string) []envService {
+	byIndex := make(map[int]*envService)
+
+	for _, kv := range environ {
+		n := strings.IndexByte(kv, '=')
+		if n < 0 || !strings.HasPrefix(kv[:n], envServicesPrefix) || kv[n+1:] == "" {
+			continue
+		}
+
+		rest := kv[len(envServicesPrefix):n]
+
+		sep := strings.IndexByte(rest, '_')
+		if sep < 1 {
+			continue
+		}
+
+		index, err := strconv.Atoi(rest[:sep])
+		if err != nil || index < 0 {
+			continue
+		}
+
+		key := envKey(rest[sep+1:])
+
+		s, ok := byIndex[index]
+		if !ok {
+			s = &envService{index: index, keys: make(map[string]bool), v: viper.New()}
+			byIndex[index] = s
+		}
+
+		s.keys[key] = true
+		s.v.Set(key, kv[n+1:])
+	}
+
+	list := make([]envService, 0, len(byIndex))
+	for _, s := range byIndex {
+		list = append(list, *s)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].index < list[j].index })
+
+	return list
+}
+
+// envKey returns the key of the field named name in an environment variable.
+func envKey(name string) string {
+	for _, field := range envMapFields {
+		if strings.HasPrefix(strings.ToUpper(name), field+"_") && len(name) > len(field)+1 {
+			return strings.ToLower(field + "." + strings.Replace(name[len(field)+1:], "__", "-", -1))
+		}
+	}
+
+	// the field names have no underscores, nested fields are separated by one
+	return strings.ToLower(strings.Replace(name, "_", ".", -1))
+}
+
+// mergeEnvServices adds to services the ones defined in environ, in the
+// order of their index. A service with the tenant and name of one of
+// services overrides the fields it sets. It returns the keys set by the
+// environment by service index.
+func mergeEnvServices(services []ServiceConfig, environ []string) ([]ServiceConfig, map[int]map[string]bool, error) {
+	fromEnv := make(map[int]map[string]bool)
+
+	for _, s := range envServices(environ) {
+		var decoded ServiceConfig
+		if err := s.v.Unmarshal(&decoded); err != nil {
+			return nil, nil, errors.Wrapf(err, "%s%d", envServicesPrefix, s.index)
+		}
+
+		i := indexOf(services, decoded.TenantID, decoded.Name)
+		if i < 0 {
+			services = append(services, decoded)
+			fromEnv[len(services)-1] = s.keys
+			continue
+		}
+
+		if err := s.v.Unmarshal(&services[i]); err != nil {
+			return nil, nil, errors.Wrapf(err, "%s%d", envServicesPrefix, s.index)
+		}
+
+		fromEnv[i] = s.keys
+	}
+
+	return services, fromEnv, nil
+}
+
+// indexOf returns the index of the service of tenant named name, or -1.
+func indexOf(services []ServiceConfig, tenant, name string) int {
+	if name == "" {
+		return -1
+	}
+
+	for i, s := range services {
+		if s.TenantID == tenant && s.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mergeEnvServices(t *testing.T) {
+	file := []ServiceConfig{{
+		Name:     "ssp",
+		TenantID: "delivery",
+		GroupID:  "delivery-ssp",
+		Retry:    3,
+		Timeout:  time.Second,
+		HTTP:     HTTPClientConfig{UserAgent: "ns"},
+	}}
+
+	services, fromEnv, err := mergeEnvServices(file, []string{
+		"NOTIFICATION_SERVICE_SERVICES_10_NAME=dsp",
+		"NOTIFICATION_SERVICE_SERVICES_10_TENANTID=billing",
+		"NOTIFICATION_SERVICE_SERVICES_10_GROUPID=billing-dsp",
+		"NOTIFICATION_SERVICE_SERVICES_10_RETRY=2",
+		"NOTIFICATION_SERVICE_SERVICES_10_TIMEOUT=5s",
+		"NOTIFICATION_SERVICE_SERVICES_2_NAME=ssp",
+		"NOTIFICATION_SERVICE_SERVICES_2_TENANTID=delivery",
+		"NOTIFICATION_SERVICE_SERVICES_2_RETRY=5",
+		"NOTIFICATION_SERVICE_SERVICES_2_HTTP_DIALTIMEOUT=2s",
+		"NOTIFICATION_SERVICE_SERVICES_2_HEADERS_AUTHORIZATION=env:PARTNER_TOKEN",
+		"NOTIFICATION_SERVICE_SERVICES_2_HEADERS_X__API__KEY=env:PARTNER_KEY",
+		"NOTIFICATION_SERVICE_SERVICES_2_QUERY_PARTNER_ID=42",
+		"NOTIFICATION_SERVICE_SERVICES_X_NAME=ignored",
+		"NOTIFICATION_SERVICE_SERVICES_3_NAME=",
+		"PATH=/bin",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ServiceConfig{
+		{
+			Name:     "ssp",
+			TenantID: "delivery",
+			GroupID:  "delivery-ssp",
+			Retry:    5,
+			Timeout:  time.Second,
+			HTTP:     HTTPClientConfig{UserAgent: "ns", DialTimeout: 2 * time.Second},
+			Headers:  map[string]Secret{"authorization": "env:PARTNER_TOKEN", "x-api-key": "env:PARTNER_KEY"},
+			Query:    map[string]Secret{"partner_id": "42"},
+		},
+		{
+			Name:     "dsp",
+			TenantID: "billing",
+			GroupID:  "billing-dsp",
+			Retry:    2,
+			Timeout:  5 * time.Second,
+		},
+	}, services)
+
+	assert.True(t, fromEnv[0]["http.dialtimeout"])
+	assert.True(t, fromEnv[0]["headers.authorization"])
+	assert.False(t, fromEnv[0]["groupid"])
+	assert.True(t, fromEnv[1]["groupid"])
+}
+
+func Test_envKey(t *testing.T) {
+	for name, key := range map[string]string{
+		"TENANTID":            "tenantid",
+		"HTTP_DIALTIMEOUT":    "http.dialtimeout",
+		"HEADERS_X__API__KEY": "headers.x-api-key",
+		"QUERY_PARTNER_KEY":   "query.partner_key",
+		"QUERY_LANG":          "query.lang",
+	} {
+		assert.Equal(t, key, envKey(name), name)
+	}
+}
+
+func Test_mergeEnvServices_Invalid(t *testing.T) {
+	_, _, err := mergeEnvServices(nil, []string{"NOTIFICATION_SERVICE_SERVICES_0_RETRY=many"})
+
+	assert.Error(t, err)
+}
+
+func Test_load_Services_From_Environment(t *testing.T) {
+	for k, v := range map[string]string{
+		"NOTIFICATION_SERVICE_SERVICES_0_NAME":      "dsp",
+		"NOTIFICATION_SERVICE_SERVICES_0_TENANTID":  "billing",
+		"NOTIFICATION_SERVICE_SERVICES_0_GROUPID":   "billing-dsp",
+		"NOTIFICATION_SERVICE_SERVICES_0_RETRY":     "2",
+		"NOTIFICATION_SERVICE_SERVICES_0_TIMEOUT":   "5s",
+		"NOTIFICATION_SERVICE_SERVICES_0_BASEURL":   "https://billing.example",
+		"NOTIFICATION_SERVICE_SERVICES_0_HEADERS_X": "1",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c := loadFile(t, effectiveTOML)
+
+	if assert.Len(t, c.Services, 2) {
+		assert.Equal(t, "billing-dsp", c.Services[1].Topic)
+	}
+
+	s := settingsByKey(c)
+	assert.Equal(t, SourceEnv, s["services[1].groupid"].Source)
+	assert.Equal(t, SourceDefault, s["services[1].retrydelay"].Source)
+	assert.Equal(t, SourceFile, s["services[0].groupid"].Source)
+	assert.Equal(t, SourceEnv, s["services[1].headers"].Source)
+}
@@ -4,3 +4,9 @@ import "errors"
 
 // ErrRequiredParameter is raised when there is no required configuraion parameter
 var ErrRequiredParameter = errors.New("missing required parameter")
+
+// ErrInvalidParameter is raised when a configuration parameter has an invalid value
+var ErrInvalidParameter = errors.New("invalid parameter")
+
+// ErrSecret is raised when a secret reference cannot be resolved
+var ErrSecret = errors.New("unable to resolve secret")
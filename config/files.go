@@ -0,0 +1,289 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// errNoConfigFile is raised when the config directory has no config file.
+var errNoConfigFile = errors.New("no config file")
+
+// reloadDelay waits for the writes to the config directory to settle before
+// reading it again.
+const reloadDelay = 200 * time.Millisecond
+
+// configFiles are the config files read, in order.
+type configFiles struct {
+	paths []string
+	each  []*viper.Viper
+	// file and content of each service of the files, in order
+	servicePaths []string
+	services     []map[string]interface{}
+}
+
+// files are the config files read last.
+var files *configFiles
+
+// isConfigFile reports whether path has the extension of a config file.
+func isConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml", ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// configDir returns CONFIG_PATH when it is a directory, whose config files
+// are all read.
+func configDir() string {
+	path := viper.GetString("CONFIG_PATH")
+
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return path
+	}
+
+	return ""
+}
+
+// isNotFound reports whether err is raised because there is no config file.
+func isNotFound(err error) bool {
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		return true
+	}
+
+	return errors.Cause(err) == errNoConfigFile
+}
+
+// readConfig reads the config file, or every config file of the directory
+// CONFIG_PATH.
+func readConfig() error {
+	if dir := configDir(); dir != "" {
+		return readConfigDir(dir)
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		files = nil
+		return err
+	}
+
+	f, _, err := readConfigFiles([]string{viper.ConfigFileUsed()})
+	files = f
+
+	return err
+}
+
+// readConfigDir reads the config files of dir in lexical order: the settings
+// of a file override the ones of the files before, and the services of all
+// the files are kept.
+func readConfigDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && isConfigFile(e.Name()) {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	if len(paths) == 0 {
+		files = nil
+		return errors.Wrap(errNoConfigFile, dir)
+	}
+
+	f, merged, err := readConfigFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return errors.Wrap(err, dir)
+	}
+
+	viper.SetConfigType("json")
+	if err = viper.ReadConfig(bytes.NewReader(b)); err != nil {
+		return errors.Wrap(err, dir)
+	}
+
+	files = f
+
+	return nil
+}
+
+// readConfigFiles reads paths, and returns them with their merged settings.
+func readConfigFiles(paths []string) (*configFiles, map[string]interface{}, error) {
+	f := &configFiles{paths: paths}
+	merged := viper.New()
+
+	var services []interface{}
+
+	for _, path := range paths {
+		v := viper.New()
+		v.SetConfigFile(path)
+
+		if err := v.ReadInConfig(); err != nil {
+			return nil, nil, errors.Wrap(err, path)
+		}
+
+		f.each = append(f.each, v)
+
+		list, _ := normalize(v.Get("services")).([]interface{})
+		for _, s := range list {
+			m, ok := s.(map[string]interface{})
+			if !ok {
+				return nil, nil, errors.Errorf("%s: services: %v is not a table", path, s)
+			}
+
+			f.servicePaths = append(f.servicePaths, path)
+			f.services = append(f.services, m)
+			services = append(services, m)
+		}
+
+		settings, _ := normalize(v.AllSettings()).(map[string]interface{})
+		delete(settings, "services")
+
+		if err := merged.MergeConfigMap(settings); err != nil {
+			return nil, nil, errors.Wrap(err, path)
+		}
+	}
+
+	settings := merged.AllSettings()
+	if len(services) > 0 {
+		settings["services"] = services
+	}
+
+	return f, settings, nil
+}
+
+// fileOf returns the last file setting key, or "".
+func (f *configFiles) fileOf(key string) string {
+	if f == nil {
+		return ""
+	}
+
+	for i := len(f.each) - 1; i >= 0; i-- {
+		if f.each[i].IsSet(key) {
+			return f.paths[i]
+		}
+	}
+
+	return ""
+}
+
+// serviceFileOf returns the file setting the field key of the i-th service,
+// or "".
+func (f *configFiles) serviceFileOf(i int, key string) string {
+	if f == nil || i >= len(f.services) || !lookup(f.services[i], strings.Split(key, ".")) {
+		return ""
+	}
+
+	return f.servicePaths[i]
+}
+
+// normalize converts the maps decoded from yaml, keyed by interface{}, to
+// maps keyed by string.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[k] = normalize(e)
+		}
+
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, e := range x {
+			l[i] = normalize(e)
+		}
+
+		return l
+	case []map[string]interface{}:
+		l := make([]interface{}, len(x))
+		for i, e := range x {
+			l[i] = normalize(e)
+		}
+
+		return l
+	default:
+		return v
+	}
+}
+
+// watchDir calls onChange with the configuration read again whenever the
+// content of dir changes. Any change is considered, as the files of mounted
+// volumes are replaced through symbolic links.
+func watchDir(dir string, onChange func(*Configuration, error)) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to watch the config directory")
+		return
+	}
+
+	if err = w.Add(dir); err != nil {
+		w.Close()
+		log.Error().Err(err).Str("dir", dir).Msg("unable to watch the config directory")
+		return
+	}
+
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		var timer *time.Timer
+
+		for {
+			select {
+			case _, ok := <-w.Events:
+				if !ok {
+					return
+				}
+
+				if timer == nil {
+					timer = time.AfterFunc(reloadDelay, func() {
+						select {
+						case changed <- struct{}{}:
+						default:
+						}
+					})
+				} else {
+					timer.Reset(reloadDelay)
+				}
+			case <-changed:
+				if err := readConfig(); err != nil {
+					onChange(nil, err)
+					continue
+				}
+
+				onChange(load())
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+
+				log.Error().Err(err).Str("dir", dir).Msg("error watching the config directory")
+			}
+		}
+	}()
+}
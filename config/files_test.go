@@ -0,0 +1,74 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_readConfig_Directory(t *testing.T) {
+	dir := writeConfig(t, map[string]string{
+		"10-base.toml": `
+[App]
+Port = 11000
+[Admin]
+Port = 0
+[Log]
+Level = "info"
+[Kafka]
+Brokers = ["localhost:9092"]
+[[Services]]
+Name = "ssp"
+TenantId = "delivery"
+GroupID = "delivery-ssp"
+Retry = 3
+Timeout = "1s"
+`,
+		"20-billing.yaml": `
+log:
+  level: warn
+services:
+  - name: dsp
+    tenantid: billing
+    groupid: billing-dsp
+    retry: 2
+    timeout: 5s
+    http:
+      dialtimeout: 2s
+`,
+		"30-empty.json": `{}`,
+		"README.md":     "ignored",
+	})
+
+	c := loadConfig(t, dir)
+
+	assert.Equal(t, 11000, c.App.Port)
+	assert.Equal(t, "warn", c.Log.Level)
+	assert.Equal(t, []string{"localhost:9092"}, c.Kafka.Brokers)
+
+	if assert.Len(t, c.Services, 2) {
+		assert.Equal(t, "ssp", c.Services[0].Name)
+		assert.Equal(t, "dsp", c.Services[1].Name)
+		assert.Equal(t, "billing-dsp", c.Services[1].Topic)
+		assert.Equal(t, "2s", c.Services[1].HTTP.DialTimeout.String())
+	}
+
+	s := settingsByKey(c)
+	assert.Equal(t, filepath.Join(dir, "20-billing.yaml"), s["log.level"].File)
+	assert.Equal(t, filepath.Join(dir, "10-base.toml"), s["app.port"].File)
+	assert.Equal(t, filepath.Join(dir, "20-billing.yaml"), s["services[1].http.dialtimeout"].File)
+	assert.Equal(t, "", s["services[1].topic"].File)
+}
+
+func Test_readConfig_Empty_Directory(t *testing.T) {
+	dir := writeConfig(t, nil)
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("CONFIG_PATH", dir)
+
+	assert.True(t, isNotFound(readConfig()))
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	secretFilePrefix = "file://"
+	secretEnvPrefix  = "env:"
+	secretMask       = "******"
+)
+
+// Secret is a configuration value which is never printed. It holds either the
+// value itself or a reference to where the value lives:
+//
+//	file:///run/secrets/kafka-password  the content of the file
+//	env:KAFKA_PASSWORD                  the value of the environment variable
+//
+// References are resolved on every call to Value, so a rotated file or
+// variable is picked up without restart.
+type Secret string
+
+// secretFile caches the content of a secret file until it is modified.
+type secretFile struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+var secretFiles = struct {
+	sync.Mutex
+	m map[string]secretFile
+}{m: map[string]secretFile{}}
+
+// Value resolves the secret.
+func (s Secret) Value() (string, error) {
+	raw := string(s)
+
+	switch {
+	case strings.HasPrefix(raw, secretFilePrefix):
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", errors.Wrap(ErrSecret, err.Error())
+		}
+
+		return readSecretFile(u.Path)
+	case strings.HasPrefix(raw, secretEnvPrefix):
+		name := raw[len(secretEnvPrefix):]
+
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Wrapf(ErrSecret, "environment variable %s is not set", name)
+		}
+
+		return v, nil
+	default:
+		return raw, nil
+	}
+}
+
+// IsSet reports whether the secret holds a value or a reference.
+func (s Secret) IsSet() bool {
+	return s != ""
+}
+
+// String masks the secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return secretMask
+}
+
+// display returns the reference of the secret, which is not secret itself,
+// or the mask when it holds the value.
+func (s Secret) display() string {
+	raw := string(s)
+	if strings.HasPrefix(raw, secretFilePrefix) || strings.HasPrefix(raw, secretEnvPrefix) {
+		return raw
+	}
+
+	return s.String()
+}
+
+// GoString masks the secret in %#v output.
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// MarshalText masks the secret in encoded output.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// readSecretFile returns the trimmed content of path, reading it again only
+// when its size or modification time changed.
+func readSecretFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(ErrSecret, err.Error())
+	}
+
+	secretFiles.Lock()
+	defer secretFiles.Unlock()
+
+	if f, ok := secretFiles.m[path]; ok && f.modTime.Equal(fi.ModTime()) && f.size == fi.Size() {
+		return f.value, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(ErrSecret, err.Error())
+	}
+
+	v := strings.TrimRight(string(b), "\r\n")
+
+	secretFiles.m[path] = secretFile{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		value:   v,
+	}
+
+	return v, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret_Value_Literal(t *testing.T) {
+	v, err := Secret("plain").Value()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", v)
+}
+
+func TestSecret_Value_Env(t *testing.T) {
+	os.Setenv("NS_TEST_SECRET", "from-env")
+	defer os.Unsetenv("NS_TEST_SECRET")
+
+	v, err := Secret("env:NS_TEST_SECRET").Value()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", v)
+
+	_, err = Secret("env:NS_TEST_SECRET_MISSING").Value()
+
+	assert.Error(t, err)
+}
+
+func TestSecret_Value_File_Is_Reread_On_Change(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("first\n"), 0600))
+
+	s := Secret("file://" + path)
+
+	v, err := s.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", v)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("second\n"), 0600))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+
+	v, err = s.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", v)
+}
+
+func TestSecret_Is_Masked(t *testing.T) {
+	k := KafkaConfig{Password: Secret("hunter2")}
+
+	assert.NotContains(t, fmt.Sprintf("%v", k), "hunter2")
+	assert.NotContains(t, fmt.Sprintf("%+v", k), "hunter2")
+	assert.NotContains(t, fmt.Sprintf("%#v", k), "hunter2")
+
+	b, err := json.Marshal(k)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "hunter2")
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Default topic name templates
+const (
+	DefaultTopicTemplate      = "{{.TenantID}}-{{.Name}}"
+	DefaultErrorTopicTemplate = "{{.TenantID}}-{{.Name}}-error"
+)
+
+// validTopic matches the topic names accepted by kafka.
+var validTopic = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// topicNames returns the topic and the error topic of service: the ones set
+// on the service, or the ones given by the templates of topics.
+func topicNames(topics TopicsConfig, service ServiceConfig) (string, string, error) {
+	topic := service.Topic
+	if topic == "" {
+		t, err := executeTopic(topics.Template, service)
+		if err != nil {
+			return "", "", errors.Wrap(err, "topics.template")
+		}
+
+		topic = t
+	}
+
+	errTopic := service.Error
+	if errTopic == "" {
+		t, err := executeTopic(topics.ErrorTemplate, service)
+		if err != nil {
+			return "", "", errors.Wrap(err, "topics.errorTemplate")
+		}
+
+		errTopic = t
+	}
+
+	return topic, errTopic, nil
+}
+
+// executeTopic returns the topic name given by text for service.
+func executeTopic(text string, service ServiceConfig) (string, error) {
+	tmpl, err := template.New("topic").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, service); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
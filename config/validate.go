@@ -0,0 +1,325 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/httpclient"
+	"github.com/vladimir-klymniuk/notification-service-original/kafka"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/tracing"
+)
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []error
+}
+
+// Error returns the problems, separated by semicolons.
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		s[i] = p.Error()
+	}
+
+	return strings.Join(s, "; ")
+}
+
+// problems collects the problems of a configuration.
+type problems []error
+
+func (p *problems) required(name string) {
+	*p = append(*p, errors.Wrap(ErrRequiredParameter, name))
+}
+
+func (p *problems) invalid(name, format string, args ...interface{}) {
+	*p = append(*p, errors.Wrapf(ErrInvalidParameter, "%s: %s", name, fmt.Sprintf(format, args...)))
+}
+
+func (p *problems) add(name string, err error) {
+	*p = append(*p, errors.Wrap(err, name))
+}
+
+// validate checks the whole configuration, and returns a ValidationError
+// listing all its problems.
+func validate(config *Configuration) error {
+	var p problems
+
+	validateApp(&p, config)
+	validateKafka(&p, config.Kafka)
+	validateServices(&p, config.Services)
+	validateTopics(&p, config.Topics, config.Services)
+
+	if err := logging.Validate(config.Log.Logging()); err != nil {
+		p.invalid("log", "%v", err)
+	}
+
+	validateEncryption(&p, config.Encryption)
+	validateAudit(&p, config.Audit)
+	validateTracing(&p, config.Tracing)
+
+	if config.Metrics.MaxHosts < 0 {
+		p.invalid("metrics.maxHosts", "must not be negative")
+	}
+
+	if config.Metrics.ConsumerLagInterval < 0 {
+		p.invalid("metrics.consumerLagInterval", "must not be negative")
+	}
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+
+	return nil
+}
+
+func validateApp(p *problems, config *Configuration) {
+	if config.App.Port < 1 || config.App.Port > 65535 {
+		p.invalid("app.port", "%d is not a port", config.App.Port)
+	}
+
+	if config.App.ReadinessTimeout <= 0 {
+		p.invalid("app.readinessTimeout", "must be positive")
+	}
+
+	if config.App.DrainTimeout < 0 {
+		p.invalid("app.drainTimeout", "must not be negative")
+	}
+
+	if config.App.ProducerFailureWindow <= 0 {
+		p.invalid("app.producerFailureWindow", "must be positive")
+	}
+
+	if config.Admin.Port < 0 || config.Admin.Port > 65535 {
+		p.invalid("admin.port", "%d is not a port", config.Admin.Port)
+	}
+
+	if config.Admin.Port != 0 && config.Admin.Port == config.App.Port {
+		p.invalid("admin.port", "must differ from app.port")
+	}
+
+	if config.Admin.Port != 0 {
+		if _, err := config.Admin.Token.Value(); err != nil {
+			p.add("admin.token", err)
+		}
+	}
+}
+
+func validateKafka(p *problems, c KafkaConfig) {
+	if len(c.Brokers) == 0 {
+		p.required("kafka.brokers")
+	}
+
+	for _, b := range c.Brokers {
+		if strings.TrimSpace(b) == "" {
+			p.invalid("kafka.brokers", "empty broker address")
+		}
+	}
+
+	if c.UseCredentials {
+		if c.Username == "" {
+			p.required("kafka.username")
+		}
+
+		if _, err := c.Password.Value(); err != nil {
+			p.add("kafka.password", err)
+		}
+	}
+
+	// the credentials are checked above
+	cc := c.Client()
+	cc.Password = nil
+
+	if _, err := kafka.NewConfig(cc); err != nil {
+		p.add("kafka", err)
+	}
+}
+
+func validateServices(p *problems, services []ServiceConfig) {
+	if len(services) == 0 {
+		p.required("services")
+	}
+
+	// a name is unique per tenant
+	keys := make(map[string]int, len(services))
+
+	for i, service := range services {
+		name := fmt.Sprintf("services[%d]", i)
+		if service.Name != "" {
+			name = fmt.Sprintf("services[%d] (%s)", i, service.Name)
+		}
+
+		if service.Name == "" {
+			p.required(name + ".name")
+		} else if j, ok := keys[service.TenantID+"/"+service.Name]; ok {
+			p.invalid(name+".name", "duplicate of services[%d]", j)
+		} else {
+			keys[service.TenantID+"/"+service.Name] = i
+		}
+
+		if service.TenantID == "" {
+			p.required(name + ".tenantId")
+		}
+
+		if service.GroupID == "" {
+			p.required(name + ".groupId")
+		}
+
+		if service.Retry < 1 {
+			p.invalid(name+".retry", "must be at least 1, %d attempts never deliver", service.Retry)
+		}
+
+		if service.RetryDelay < 0 {
+			p.invalid(name+".retryDelay", "must not be negative")
+		}
+
+		if service.Timeout <= 0 {
+			p.invalid(name+".timeout", "must be positive")
+		}
+
+		if service.MaxRequests < 0 {
+			p.invalid(name+".maxRequests", "must not be negative")
+		}
+
+		validateHTTPClient(p, name+".http", service.HTTP)
+
+		if _, err := httpclient.New(service.Client()); err != nil {
+			p.add(name+".http", err)
+		}
+
+		validateDestination(p, name, service)
+	}
+}
+
+func validateDestination(p *problems, name string, service ServiceConfig) {
+	if service.BaseURL != "" {
+		if _, err := destination.New(destination.Config{BaseURL: service.BaseURL}); err != nil {
+			p.invalid(name+".baseURL", "must be an absolute http url")
+		}
+	}
+
+	if service.URLTemplate != "" {
+		if _, err := destination.New(destination.Config{Template: service.URLTemplate}); err != nil {
+			p.add(name+".urlTemplate", err)
+		}
+	}
+
+	// the defaults are only sent to the host of the base url
+	if service.BaseURL == "" && (len(service.Query) > 0 || len(service.Headers) > 0) {
+		p.invalid(name+".baseURL", "is required by the query parameters and headers")
+	}
+}
+
+func validateTopics(p *problems, topics TopicsConfig, services []ServiceConfig) {
+	seen := make(map[string]string)
+
+	for i, service := range services {
+		name := fmt.Sprintf("services[%d] (%s)", i, service.Name)
+
+		topic, errTopic, err := topicNames(topics, service)
+		if err != nil {
+			p.invalid(name, "%v", err)
+			continue
+		}
+
+		for _, t := range []struct{ field, topic string }{{"topic", topic}, {"error", errTopic}} {
+			if !validTopic.MatchString(t.topic) {
+				p.invalid(name+"."+t.field, "%q is not a valid topic name", t.topic)
+				continue
+			}
+
+			if other, ok := seen[t.topic]; ok {
+				p.invalid(name+"."+t.field, "%q is already the topic of %s", t.topic, other)
+				continue
+			}
+
+			seen[t.topic] = name + "." + t.field
+		}
+	}
+}
+
+func validateHTTPClient(p *problems, name string, h HTTPClientConfig) {
+	durations := []struct {
+		field string
+		d     time.Duration
+	}{
+		{"dialTimeout", h.DialTimeout},
+		{"tlsHandshakeTimeout", h.TLSHandshakeTimeout},
+		{"responseHeaderTimeout", h.ResponseHeaderTimeout},
+		{"idleConnTimeout", h.IdleConnTimeout},
+	}
+
+	for _, d := range durations {
+		if d.d < 0 {
+			p.invalid(name+"."+d.field, "must not be negative")
+		}
+	}
+
+	if h.MaxIdleConns < 0 || h.MaxIdleConnsPerHost < 0 || h.MaxConnsPerHost < 0 {
+		p.invalid(name, "connection limits must not be negative")
+	}
+}
+
+func validateEncryption(p *problems, encryption EncryptionConfig) {
+	if encryption.Keyring == "" {
+		if encryption.Enabled {
+			p.required("encryption.keyring")
+		}
+
+		return
+	}
+
+	if _, err := os.Stat(encryption.Keyring); err != nil {
+		p.invalid("encryption.keyring", "%v", err)
+	}
+}
+
+func validateAudit(p *problems, audit AuditConfig) {
+	switch audit.Sink {
+	case "":
+	case AuditSinkFile:
+		if audit.Path == "" {
+			p.required("audit.path")
+		}
+
+		if audit.MaxSizeMB < 0 {
+			p.invalid("audit.maxSizeMB", "must not be negative")
+		}
+
+		if audit.MaxBackups < 0 {
+			p.invalid("audit.maxBackups", "must not be negative")
+		}
+	case AuditSinkKafka:
+		if audit.Topic == "" {
+			p.required("audit.topic")
+		}
+	default:
+		p.invalid("audit.sink", "%q is not %q or %q", audit.Sink, AuditSinkFile, AuditSinkKafka)
+	}
+}
+
+func validateTracing(p *problems, t TracingConfig) {
+	switch t.Exporter {
+	case "", tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		if t.Endpoint == "" {
+			p.required("tracing.endpoint")
+		}
+	case tracing.ExporterFile:
+		if t.Path == "" {
+			p.required("tracing.path")
+		}
+	default:
+		p.invalid("tracing.exporter", "%q is not one of %q, %q, %q", t.Exporter,
+			tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterFile)
+	}
+
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		p.invalid("tracing.sampleRatio", "%v is not between 0 and 1", t.SampleRatio)
+	}
+}
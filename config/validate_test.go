@@ -0,0 +1,181 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() *Configuration {
+	return &Configuration{
+		App:   AppConfig{Port: 11000, ReadinessTimeout: time.Second, ProducerFailureWindow: time.Minute},
+		Kafka: KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Log:   LogConfig{Level: "info"},
+		Services: []ServiceConfig{{
+			Name:     "ssp",
+			TenantID: "delivery",
+			GroupID:  "delivery-ssp",
+			Retry:    3,
+			Timeout:  time.Second,
+		}},
+		Topics:  TopicsConfig{Template: DefaultTopicTemplate, ErrorTemplate: DefaultErrorTopicTemplate},
+		Tracing: TracingConfig{SampleRatio: 1},
+	}
+}
+
+func Test_validate_Valid(t *testing.T) {
+	assert.NoError(t, validate(validConfig()))
+}
+
+func Test_validate_Reports_All_Problems(t *testing.T) {
+	c := validConfig()
+	c.Kafka.Brokers = nil
+	c.Audit.Sink = "s3"
+	c.Services[0].Retry = 0
+	c.Services[0].Timeout = 0
+	c.Services = append(c.Services,
+		ServiceConfig{Name: "ssp", TenantID: "delivery", Retry: 1, Timeout: time.Second},
+		ServiceConfig{Name: "ssp", Retry: 1, Timeout: time.Second},
+	)
+
+	err := validate(c)
+
+	v, ok := err.(*ValidationError)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	var got []string
+	for _, p := range v.Problems {
+		got = append(got, p.Error())
+	}
+
+	assert.Equal(t, []string{
+		"kafka.brokers: missing required parameter",
+		"services[0] (ssp).retry: must be at least 1, 0 attempts never deliver: invalid parameter",
+		"services[0] (ssp).timeout: must be positive: invalid parameter",
+		"services[1] (ssp).name: duplicate of services[0]: invalid parameter",
+		"services[1] (ssp).groupId: missing required parameter",
+		"services[2] (ssp).tenantId: missing required parameter",
+		"services[2] (ssp).groupId: missing required parameter",
+		`services[1] (ssp).topic: "delivery-ssp" is already the topic of services[0] (ssp).topic: invalid parameter`,
+		`services[1] (ssp).error: "delivery-ssp-error" is already the topic of services[0] (ssp).error: invalid parameter`,
+		`audit.sink: "s3" is not "file" or "kafka": invalid parameter`,
+	}, got)
+
+	assert.Equal(t, ErrRequiredParameter, errors.Cause(v.Problems[0]))
+	assert.Equal(t, ErrInvalidParameter, errors.Cause(v.Problems[1]))
+}
+
+func Test_validate_Allows_A_Name_In_Several_Tenants(t *testing.T) {
+	c := validConfig()
+
+	billing := c.Services[0]
+	billing.TenantID = "billing"
+	billing.GroupID = "billing-ssp"
+	c.Services = append(c.Services, billing)
+
+	assert.NoError(t, validate(c))
+}
+
+func Test_validate_Requires_Services(t *testing.T) {
+	c := validConfig()
+	c.Services = nil
+
+	assert.EqualError(t, validate(c), "services: missing required parameter")
+}
+
+func Test_topicNames(t *testing.T) {
+	topics := TopicsConfig{Template: "prod.{{.TenantID}}.{{.Name}}", ErrorTemplate: DefaultErrorTopicTemplate}
+	service := ServiceConfig{Name: "ssp", TenantID: "delivery"}
+
+	topic, errTopic, err := topicNames(topics, service)
+	assert.NoError(t, err)
+	assert.Equal(t, "prod.delivery.ssp", topic)
+	assert.Equal(t, "delivery-ssp-error", errTopic)
+
+	service.Topic = "legacy-ssp"
+	topic, _, err = topicNames(topics, service)
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-ssp", topic)
+
+	_, _, err = topicNames(TopicsConfig{Template: "{{.Tenant}}"}, ServiceConfig{})
+	assert.Error(t, err)
+}
+
+func Test_validate_Topics(t *testing.T) {
+	c := validConfig()
+	c.Services = append(c.Services, c.Services[0])
+	c.Services[1].Name = "dsp"
+	c.Services[1].Topic = "delivery-ssp"
+	c.Services[1].Error = "delivery dsp errors"
+
+	assert.EqualError(t, validate(c), `services[1] (dsp).topic: "delivery-ssp" is already the topic of services[0] (ssp).topic: invalid parameter; `+
+		`services[1] (dsp).error: "delivery dsp errors" is not a valid topic name: invalid parameter`)
+}
+
+func Test_validate_Kafka_Tuning(t *testing.T) {
+	c := validConfig()
+	c.Kafka.Version = "2.4"
+	c.Kafka.Consumer.RebalanceStrategy = "random"
+
+	err := validate(c)
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Len(t, err.(*ValidationError).Problems, 1)
+		assert.Contains(t, err.Error(), `kafka: version "2.4"`)
+	}
+}
+
+func Test_validate_Destination(t *testing.T) {
+	c := validConfig()
+	c.Services[0].BaseURL = "partner.example/api"
+	c.Services[0].URLTemplate = "{{.BaseURL}/orders"
+
+	err := validate(c)
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Len(t, err.(*ValidationError).Problems, 2)
+		assert.Contains(t, err.Error(), "services[0] (ssp).baseURL: must be an absolute http url")
+		assert.Contains(t, err.Error(), "services[0] (ssp).urlTemplate: ")
+	}
+
+	c.Services[0].BaseURL = ""
+	c.Services[0].URLTemplate = ""
+	c.Services[0].Headers = map[string]Secret{"authorization": "Bearer t"}
+
+	err = validate(c)
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Len(t, err.(*ValidationError).Problems, 1)
+		assert.Contains(t, err.Error(), "services[0] (ssp).baseURL: is required by the query parameters and headers")
+	}
+
+	c.Services[0].BaseURL = "https://partner.example/api"
+	c.Services[0].URLTemplate = "{{.BaseURL}}/orders/{{.Variables.order}}"
+	assert.NoError(t, validate(c))
+}
+
+func Test_ServiceConfig_Destination(t *testing.T) {
+	os.Setenv("PARTNER_KEY", "k1")
+	defer os.Unsetenv("PARTNER_KEY")
+
+	s := ServiceConfig{
+		BaseURL: "https://partner.example/api",
+		Query:   map[string]Secret{"key": "env:PARTNER_KEY"},
+		Headers: map[string]Secret{"authorization": "Bearer t"},
+	}
+
+	d := s.Destination()
+	assert.Equal(t, "https://partner.example/api", d.BaseURL)
+
+	v, err := d.Query["key"]()
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", v)
+
+	v, err = d.Headers["authorization"]()
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer t", v)
+
+	assert.Nil(t, ServiceConfig{}.Destination().Headers)
+}
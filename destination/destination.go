@@ -0,0 +1,349 @@
+// Package destination builds the URLs of the notifications of a service from
+// its base URL, URL template and default query parameters, so that callers
+// only send a path or variables. The default query parameters and headers,
+// which may be secrets, only apply to the URLs of the destination.
+package destination
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/message"
+)
+
+// ErrInvalidConfig is raised when the destination cannot be created.
+var ErrInvalidConfig = errors.New("invalid destination config")
+
+// ErrNoDestination is raised when a notification has no URL and the service
+// no destination to build one.
+var ErrNoDestination = errors.New("no http_request and no destination")
+
+// ErrInvalidPath is raised when the path of a notification is not a relative path.
+var ErrInvalidPath = errors.New("invalid path")
+
+// ErrInvalidURL is raised when the URL built is not an absolute http URL.
+var ErrInvalidURL = errors.New("invalid url")
+
+// placeholder replaces a variable to find where the template uses it.
+const placeholder = "destination-variable"
+
+// Config describes the destination of the notifications of a service.
+type Config struct {
+	// BaseURL the path of the notifications is appended to
+	BaseURL string
+	// Template is a text/template of the URL, executed with .BaseURL, .Path
+	// and .Variables, e.g. "{{.BaseURL}}/orders/{{.Variables.order}}"
+	Template string
+	// Query parameters added to the URLs without them, the values are
+	// resolved on each notification
+	Query map[string]func() (string, error)
+	// Headers set on the requests, the values are resolved on each notification
+	Headers map[string]func() (string, error)
+}
+
+// Destination builds the URLs of the notifications of a service.
+type Destination struct {
+	base string
+	// scheme and host of base
+	scheme, host string
+	tmpl         *template.Template
+	query        map[string]func() (string, error)
+	// names of query, in order
+	names   []string
+	headers map[string]func() (string, error)
+}
+
+// templateData is the data of the URL template.
+type templateData struct {
+	BaseURL   string
+	Path      string
+	Variables map[string]string
+}
+
+// Default returns the destination of the services without one: only the
+// notifications with an http_request are delivered.
+func Default() *Destination {
+	return &Destination{}
+}
+
+// New creates the destination described by cfg.
+func New(cfg Config) (*Destination, error) {
+	d := &Destination{base: cfg.BaseURL, query: cfg.Query, headers: cfg.Headers}
+
+	if cfg.BaseURL != "" {
+		if err := checkURL(cfg.BaseURL); err != nil {
+			return nil, errors.Wrapf(ErrInvalidConfig, "base url %q", cfg.BaseURL)
+		}
+
+		u, _ := url.Parse(cfg.BaseURL)
+		d.scheme, d.host = u.Scheme, u.Host
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.New("url").Option("missingkey=error").Parse(cfg.Template)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidConfig, err.Error())
+		}
+
+		d.tmpl = tmpl
+	}
+
+	for name := range cfg.Query {
+		d.names = append(d.names, name)
+	}
+
+	sort.Strings(d.names)
+
+	return d, nil
+}
+
+// URL returns the URL of m: its http_request, or the one given by its path
+// and variables, with the default query parameters it lacks.
+func (d *Destination) URL(m message.Message) (string, error) {
+	raw, err := d.raw(m)
+	if err != nil {
+		return "", err
+	}
+
+	if len(d.names) == 0 || !d.owns(raw) {
+		return raw, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.Wrap(ErrInvalidURL, err.Error())
+	}
+
+	// the defaults are appended, the query of the URL is kept as is, since
+	// signatures may depend on it
+	q := u.Query()
+	extra := url.Values{}
+
+	for _, name := range d.names {
+		if _, ok := q[name]; ok {
+			continue
+		}
+
+		v, err := d.query[name]()
+		if err != nil {
+			return "", errors.Wrapf(err, "query parameter %s", name)
+		}
+
+		extra.Set(name, v)
+	}
+
+	if len(extra) == 0 {
+		return raw, nil
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+
+	u.RawQuery += extra.Encode()
+
+	return u.String(), nil
+}
+
+// Header returns the default headers of the request of m, resolved, or nil
+// when they do not apply to m.
+func (d *Destination) Header(m message.Message) (http.Header, error) {
+	if len(d.headers) == 0 {
+		return nil, nil
+	}
+
+	raw, err := d.raw(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.owns(raw) {
+		return nil, nil
+	}
+
+	h := make(http.Header, len(d.headers))
+	for name, value := range d.headers {
+		v, err := value()
+		if err != nil {
+			return nil, errors.Wrapf(err, "header %s", http.CanonicalHeaderKey(name))
+		}
+
+		h.Set(name, v)
+	}
+
+	return h, nil
+}
+
+// Host returns the host m is delivered to, or "" when its URL cannot be built.
+func (d *Destination) Host(m message.Message) string {
+	raw, err := d.raw(m)
+	if err != nil {
+		return ""
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// raw returns the http_request of m, or the URL given by its path and variables.
+func (d *Destination) raw(m message.Message) (string, error) {
+	if m.HTTPRequest != "" {
+		return m.HTTPRequest, nil
+	}
+
+	return d.build(m)
+}
+
+// owns reports whether the defaults apply to raw: it has the scheme and host
+// of the base URL. A URL built from a path or variables is checked too, since
+// they can change its host. The defaults of a service are never sent to the
+// other hosts.
+func (d *Destination) owns(raw string) bool {
+	if d.host == "" {
+		return false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Scheme, d.scheme) && strings.EqualFold(u.Host, d.host)
+}
+
+// Check returns the error URL would return for m when its URL cannot be
+// built, without resolving the query parameters.
+func (d *Destination) Check(m message.Message) error {
+	if m.HTTPRequest != "" {
+		return nil
+	}
+
+	_, err := d.build(m)
+
+	return err
+}
+
+// build returns the URL given by the path and variables of m.
+func (d *Destination) build(m message.Message) (string, error) {
+	if err := checkPath(m.Path); err != nil {
+		return "", err
+	}
+
+	var raw string
+
+	switch {
+	case d.tmpl != nil:
+		// the variables are escaped so that they cannot change the host or
+		// the structure of the URL
+		vars := make(map[string]string, len(m.Variables))
+		for k, v := range m.Variables {
+			vars[k] = url.PathEscape(v)
+		}
+
+		data := templateData{BaseURL: d.base, Path: m.Path, Variables: vars}
+
+		var b strings.Builder
+		if err := d.tmpl.Execute(&b, data); err != nil {
+			return "", errors.Wrap(ErrInvalidURL, err.Error())
+		}
+
+		// PathEscape keeps "@", ":" and the dots, which change the host when
+		// the variable is a part of it
+		for k, v := range m.Variables {
+			if (strings.ContainsAny(v, "@:") || strings.HasPrefix(v, ".")) && d.inHost(data, k) {
+				return "", errors.Wrapf(ErrInvalidURL, "variable %s %q cannot be used in the host", k, v)
+			}
+		}
+
+		raw = b.String()
+	case len(m.Variables) > 0:
+		return "", errors.Wrap(ErrNoDestination, "variables need a url template")
+	case d.base != "":
+		raw = join(d.base, m.Path)
+	default:
+		return "", ErrNoDestination
+	}
+
+	if err := checkURL(raw); err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// inHost reports whether the template uses the variable name in the scheme,
+// the user info or the host of the URL.
+func (d *Destination) inHost(data templateData, name string) bool {
+	vars := make(map[string]string, len(data.Variables))
+	for k, v := range data.Variables {
+		vars[k] = v
+	}
+
+	vars[name] = placeholder
+	data.Variables = vars
+
+	var b strings.Builder
+	if err := d.tmpl.Execute(&b, data); err != nil {
+		return true
+	}
+
+	u, err := url.Parse(b.String())
+	if err != nil {
+		return true
+	}
+
+	if u.User != nil && strings.Contains(u.User.String(), placeholder) {
+		return true
+	}
+
+	return strings.Contains(u.Scheme, placeholder) || strings.Contains(u.Host, placeholder)
+}
+
+// join appends path to base.
+func join(base, path string) string {
+	if path == "" {
+		return base
+	}
+
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// checkPath returns an error unless path is a relative path, which does not
+// leave the base URL.
+func checkPath(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme != "" || u.Host != "" || strings.HasPrefix(path, "//") {
+		return errors.Wrapf(ErrInvalidPath, "%q is not a relative path", path)
+	}
+
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == ".." {
+			return errors.Wrapf(ErrInvalidPath, "%q leaves the base url", path)
+		}
+	}
+
+	return nil
+}
+
+// checkURL returns an error unless raw is an absolute http URL.
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Wrapf(ErrInvalidURL, "%q is not an absolute http url", raw)
+	}
+
+	return nil
+}
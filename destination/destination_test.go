@@ -0,0 +1,277 @@
+package destination
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/message"
+)
+
+func value(v string) func() (string, error) {
+	return func() (string, error) { return v, nil }
+}
+
+func TestDestination_URL(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		m      message.Message
+		expect string
+		err    error
+	}{
+		{
+			name:   "1 http_request without destination",
+			m:      message.Message{HTTPRequest: "http://example.com/a?b=1"},
+			expect: "http://example.com/a?b=1",
+		},
+		{
+			name: "2 no http_request and no destination",
+			m:    message.Message{Path: "/a"},
+			err:  ErrNoDestination,
+		},
+		{
+			name:   "3 path appended to the base url",
+			cfg:    Config{BaseURL: "https://partner.example/api/"},
+			m:      message.Message{Path: "/orders/1?status=paid"},
+			expect: "https://partner.example/api/orders/1?status=paid",
+		},
+		{
+			name:   "4 base url without path",
+			cfg:    Config{BaseURL: "https://partner.example/api"},
+			expect: "https://partner.example/api",
+		},
+		{
+			name: "5 absolute url as path",
+			cfg:  Config{BaseURL: "https://partner.example/api"},
+			m:    message.Message{Path: "//evil.example/x"},
+			err:  ErrInvalidPath,
+		},
+		{
+			name: "6 path leaving the base url",
+			cfg:  Config{BaseURL: "https://partner.example/api"},
+			m:    message.Message{Path: "a/../../admin"},
+			err:  ErrInvalidPath,
+		},
+		{
+			name: "7 template with escaped variables",
+			cfg: Config{
+				BaseURL:  "https://partner.example",
+				Template: "{{.BaseURL}}/orders/{{.Variables.order}}/status",
+			},
+			m:      message.Message{Variables: map[string]string{"order": "1/../x?y"}},
+			expect: "https://partner.example/orders/1%2F..%2Fx%3Fy/status",
+		},
+		{
+			name: "8 missing variable",
+			cfg:  Config{Template: "https://partner.example/orders/{{.Variables.order}}"},
+			m:    message.Message{Variables: map[string]string{"id": "1"}},
+			err:  ErrInvalidURL,
+		},
+		{
+			name: "9 variables without template",
+			cfg:  Config{BaseURL: "https://partner.example"},
+			m:    message.Message{Variables: map[string]string{"order": "1"}},
+			err:  ErrNoDestination,
+		},
+		{
+			name: "10 template giving a relative url",
+			cfg:  Config{Template: "/orders/{{.Path}}"},
+			m:    message.Message{Path: "1"},
+			err:  ErrInvalidURL,
+		},
+		{
+			name: "11 default query parameters appended",
+			cfg: Config{
+				BaseURL: "https://partner.example",
+				Query:   map[string]func() (string, error){"key": value("k"), "lang": value("en")},
+			},
+			m:      message.Message{Path: "a?z=1&lang=fr"},
+			expect: "https://partner.example/a?z=1&lang=fr&key=k",
+		},
+		{
+			name: "12 default query parameters of an http_request to the base url",
+			cfg: Config{
+				BaseURL: "https://partner.example/api",
+				Query:   map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{HTTPRequest: "https://PARTNER.example/other"},
+			expect: "https://PARTNER.example/other?key=k",
+		},
+		{
+			name: "13 no default query parameters for another host",
+			cfg: Config{
+				BaseURL: "https://partner.example/api",
+				Query:   map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{HTTPRequest: "https://evil.example/a"},
+			expect: "https://evil.example/a",
+		},
+		{
+			name: "14 no default query parameters for another scheme",
+			cfg: Config{
+				BaseURL: "https://partner.example/api",
+				Query:   map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{HTTPRequest: "http://partner.example/api"},
+			expect: "http://partner.example/api",
+		},
+		{
+			name: "15 no default query parameters without base url",
+			cfg: Config{
+				Query: map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{HTTPRequest: "http://example.com/a"},
+			expect: "http://example.com/a",
+		},
+		{
+			name: "16 unresolved query parameter",
+			cfg: Config{
+				BaseURL: "https://partner.example",
+				Query:   map[string]func() (string, error){"key": func() (string, error) { return "", errors.New("unset") }},
+			},
+			m:   message.Message{Path: "a"},
+			err: errors.New("query parameter key: unset"),
+		},
+		{
+			name: "17 no default query parameters for a path changing the host",
+			cfg: Config{
+				BaseURL:  "https://partner.example",
+				Template: "{{.BaseURL}}{{.Path}}",
+				Query:    map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{Path: ".evil.example/x"},
+			expect: "https://partner.example.evil.example/x",
+		},
+		{
+			name: "18 no default query parameters for a path adding user info",
+			cfg: Config{
+				BaseURL:  "https://partner.example",
+				Template: "https://partner.example{{.Path}}",
+				Query:    map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{Path: "@evil.example/x"},
+			expect: "https://partner.example@evil.example/x",
+		},
+		{
+			name: "19 no default query parameters for a template of another host",
+			cfg: Config{
+				BaseURL:  "https://partner.example",
+				Template: "https://other.example/{{.Path}}",
+				Query:    map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{Path: "x"},
+			expect: "https://other.example/x",
+		},
+		{
+			name: "20 variable changing the host",
+			cfg: Config{
+				BaseURL:  "https://a.partner.example",
+				Template: "https://{{.Variables.tenant}}.partner.example/x",
+				Query:    map[string]func() (string, error){"key": value("k")},
+			},
+			m:   message.Message{Variables: map[string]string{"tenant": "evil.example:443@a"}},
+			err: ErrInvalidURL,
+		},
+		{
+			name: "21 variable with a leading dot after the host",
+			cfg:  Config{Template: "https://partner.example{{.Variables.suffix}}/x"},
+			m:    message.Message{Variables: map[string]string{"suffix": ".evil.example"}},
+			err:  ErrInvalidURL,
+		},
+		{
+			name: "22 variable in the host",
+			cfg: Config{
+				BaseURL:  "https://a.partner.example",
+				Template: "https://{{.Variables.tenant}}.partner.example/x",
+				Query:    map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{Variables: map[string]string{"tenant": "a"}},
+			expect: "https://a.partner.example/x?key=k",
+		},
+		{
+			name: "23 variable with @ and : in the path",
+			cfg: Config{
+				BaseURL:  "https://partner.example",
+				Template: "{{.BaseURL}}/users/{{.Variables.user}}",
+				Query:    map[string]func() (string, error){"key": value("k")},
+			},
+			m:      message.Message{Variables: map[string]string{"user": ".a:b@c.example"}},
+			expect: "https://partner.example/users/.a:b@c.example?key=k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(tt.cfg)
+			assert.NoError(t, err)
+
+			u, err := d.URL(tt.m)
+			switch {
+			case tt.err == nil:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expect, u)
+			case errors.Cause(err) == tt.err:
+			default:
+				assert.EqualError(t, err, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestDestination_Header(t *testing.T) {
+	d, err := New(Config{
+		BaseURL: "https://partner.example/api",
+		Headers: map[string]func() (string, error){"authorization": value("Bearer t")},
+	})
+	assert.NoError(t, err)
+
+	h, err := d.Header(message.Message{Path: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer t", h.Get("Authorization"))
+
+	h, err = d.Header(message.Message{HTTPRequest: "https://partner.example/b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer t", h.Get("Authorization"))
+
+	h, err = d.Header(message.Message{HTTPRequest: "https://evil.example/b"})
+	assert.NoError(t, err)
+	assert.Nil(t, h)
+
+	h, err = d.Header(message.Message{Path: "a", Variables: map[string]string{"id": "1"}})
+	assert.Equal(t, ErrNoDestination, errors.Cause(err))
+	assert.Nil(t, h)
+
+	d, err = New(Config{
+		BaseURL: "https://partner.example/api",
+		Headers: map[string]func() (string, error){"authorization": func() (string, error) { return "", errors.New("unset") }},
+	})
+	assert.NoError(t, err)
+
+	_, err = d.Header(message.Message{Path: "a"})
+	assert.EqualError(t, err, "header Authorization: unset")
+}
+
+func TestDestination_Host(t *testing.T) {
+	d, err := New(Config{
+		BaseURL:  "https://partner.example:8443/api",
+		Template: "{{.BaseURL}}/orders/{{.Variables.order}}",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "partner.example", d.Host(message.Message{Variables: map[string]string{"order": "1"}}))
+	assert.Equal(t, "example.com", d.Host(message.Message{HTTPRequest: "http://example.com/cb"}))
+	assert.Equal(t, "", d.Host(message.Message{Variables: map[string]string{"id": "1"}}))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{BaseURL: "partner.example/api"})
+	assert.Equal(t, ErrInvalidConfig, errors.Cause(err))
+
+	_, err = New(Config{Template: "{{.BaseURL"})
+	assert.Equal(t, ErrInvalidConfig, errors.Cause(err))
+
+	_, err = New(Config{BaseURL: "https://partner.example", Template: "{{.BaseURL}}/{{.Path}}"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,179 @@
+// Package health reports whether the service is ready to receive traffic.
+// Checks run concurrently on every /readyz request and the response details
+// each of them; the liveness probe (/healthz) stays independent and cheap.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// Check returns details on the state of a component, and an error when the
+// component is unhealthy.
+type Check func(ctx context.Context) (interface{}, error)
+
+// Result is the outcome of a check.
+type Result struct {
+	Name     string      `json:"name"`
+	Service  string      `json:"service,omitempty"`
+	Status   string      `json:"status"`
+	Critical bool        `json:"critical"`
+	Error    string      `json:"error,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// Report is the readiness of the service.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+type check struct {
+	name     string
+	service  string
+	critical bool
+	check    Check
+}
+
+// Checker runs the registered checks.
+type Checker struct {
+	mu      sync.RWMutex
+	checks  []*check
+	timeout time.Duration
+}
+
+// NewChecker creates a Checker giving up on checks after timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+	}
+}
+
+// Add registers a check of service, or of the whole instance when service is
+// empty. Failing critical checks make the instance not ready; the others are
+// reported only. The returned func unregisters the check.
+func (c *Checker) Add(name, service string, critical bool, fn Check) (remove func()) {
+	ch := &check{
+		name:     name,
+		service:  service,
+		critical: critical,
+		check:    fn,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, ch)
+
+	return func() {
+		c.remove(ch)
+	}
+}
+
+// remove unregisters ch.
+func (c *Checker) remove(ch *check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checks := c.checks[:0]
+	for _, registered := range c.checks {
+		if registered != ch {
+			checks = append(checks, registered)
+		}
+	}
+
+	c.checks = checks
+}
+
+// Run runs every check concurrently.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]*check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			results[i] = run(ctx, *checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: results}
+	for _, r := range results {
+		if r.Critical && r.Status != StatusOK {
+			report.Status = StatusNotReady
+		}
+	}
+
+	return report
+}
+
+// run runs ch, failing it when ctx is done first.
+func run(ctx context.Context, ch check) Result {
+	r := Result{
+		Name:     ch.name,
+		Service:  ch.service,
+		Status:   StatusOK,
+		Critical: ch.critical,
+	}
+
+	type outcome struct {
+		details interface{}
+		err     error
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := ch.check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	select {
+	case o := <-done:
+		r.Details = o.details
+		if o.err != nil {
+			r.Status = StatusFail
+			r.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		r.Status = StatusFail
+		r.Error = ctx.Err().Error()
+	}
+
+	return r
+}
+
+// ReadyzHandler returns HTTP Status 200 when every critical check passes and
+// 503 otherwise, with the result of every check.
+func (c *Checker) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if report.Status == StatusReady {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ok(context.Context) (interface{}, error) { return nil, nil }
+
+func fail(context.Context) (interface{}, error) { return nil, errors.New("down") }
+
+func slow(ctx context.Context) (interface{}, error) {
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	return nil, nil
+}
+
+func TestChecker_ReadyzHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		add    func(c *Checker)
+		code   int
+		status string
+	}{
+		{
+			name: "1 all ok",
+			add: func(c *Checker) {
+				c.Add("brokers", "", true, ok)
+				c.Add("pool", "delivery", false, ok)
+			},
+			code:   http.StatusOK,
+			status: StatusReady,
+		},
+		{
+			name: "2 critical failure",
+			add: func(c *Checker) {
+				c.Add("brokers", "", true, fail)
+			},
+			code:   http.StatusServiceUnavailable,
+			status: StatusNotReady,
+		},
+		{
+			name: "3 non critical failure",
+			add: func(c *Checker) {
+				c.Add("brokers", "", true, ok)
+				c.Add("pool", "delivery", false, fail)
+			},
+			code:   http.StatusOK,
+			status: StatusReady,
+		},
+		{
+			name: "4 timeout",
+			add: func(c *Checker) {
+				c.Add("brokers", "", true, slow)
+			},
+			code:   http.StatusServiceUnavailable,
+			status: StatusNotReady,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(20 * time.Millisecond)
+			tt.add(c)
+
+			w := httptest.NewRecorder()
+			c.ReadyzHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.code, w.Code)
+
+			var report Report
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+			assert.Equal(t, tt.status, report.Status)
+		})
+	}
+}
+
+func TestChecker_Add_Remove(t *testing.T) {
+	c := NewChecker(time.Second)
+
+	c.Add("kafka_brokers", "", true, ok)
+	remove := c.Add("producer", "delivery/ssp", true, ok)
+	c.Add("producer", "delivery/dsp", true, ok)
+
+	// the check of the pipeline replacing delivery/ssp
+	c.Add("producer", "delivery/ssp", true, ok)
+
+	remove()
+	remove()
+
+	report := c.Run(context.Background())
+	assert.Len(t, report.Checks, 3)
+	assert.Equal(t, "delivery/dsp", report.Checks[1].Service)
+	assert.Equal(t, "delivery/ssp", report.Checks[2].Service)
+}
@@ -0,0 +1,274 @@
+// Package httpclient creates the HTTP clients delivering the notifications of
+// the services.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Redirect policies
+const (
+	RedirectFollow   = "follow"
+	RedirectNone     = "none"
+	RedirectSameHost = "same-host"
+)
+
+// maxRedirects followed, as the default policy of net/http.
+const maxRedirects = 10
+
+// ErrInvalidConfig is raised when the client cannot be created.
+var ErrInvalidConfig = errors.New("invalid http client config")
+
+// ErrDestinationBlocked is raised when the client refuses to connect to the
+// address of a destination.
+var ErrDestinationBlocked = errors.New("destination blocked")
+
+// Config configures the client sending the notifications of a service.
+// Zero values keep the defaults.
+type Config struct {
+	// Timeout of each attempt, including reading the body
+	Timeout time.Duration
+	// DialTimeout of the connections, 1s by default
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout, 5s by default
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout after the request is written, none by default
+	ResponseHeaderTimeout time.Duration
+	// KeepAlive period of the TCP connections, 15s by default, negative disables it
+	KeepAlive time.Duration
+	// DisableKeepAlives opens a connection per request
+	DisableKeepAlives bool
+	// IdleConnTimeout after which an idle connection is closed, none by default
+	IdleConnTimeout time.Duration
+	// MaxIdleConns across all hosts, 50000 by default
+	MaxIdleConns int
+	// MaxIdleConnsPerHost, 50000 by default
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost, unlimited by default
+	MaxConnsPerHost int
+	// CABundle is the path of the PEM certificates trusted instead of the system ones
+	CABundle string
+	// ClientCert and ClientKey are the paths of the PEM client certificate and key
+	ClientCert string
+	ClientKey  string
+	// ProxyURL of the proxy requests are sent through, none by default
+	ProxyURL string
+	// HTTP2 attempts HTTP/2 with the destinations supporting it
+	HTTP2 bool
+	// RedirectPolicy is RedirectFollow (default), RedirectNone or RedirectSameHost
+	RedirectPolicy string
+	// UserAgent sent when set
+	UserAgent string
+	// BlockPrivateNetworks refuses to connect to loopback, private, link-local
+	// and unspecified addresses, so that the URLs of the notifications cannot
+	// reach the internal network; it cannot be used with ProxyURL
+	BlockPrivateNetworks bool
+}
+
+// New creates the client described by cfg.
+func New(cfg Config) (*http.Client, error) {
+	dialer := &net.Dialer{
+		Timeout:   durationOr(cfg.DialTimeout, time.Second),
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	if cfg.BlockPrivateNetworks {
+		if cfg.ProxyURL != "" {
+			return nil, errors.Wrap(ErrInvalidConfig, "private networks cannot be blocked behind a proxy")
+		}
+
+		// checked once resolved, so that a name cannot resolve to a blocked address
+		dialer.Control = blockPrivateNetworks
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   durationOr(cfg.TLSHandshakeTimeout, 5*time.Second),
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          intOr(cfg.MaxIdleConns, 50000),
+		MaxIdleConnsPerHost:   intOr(cfg.MaxIdleConnsPerHost, 50000),
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil || u.Host == "" {
+			return nil, errors.Wrapf(ErrInvalidConfig, "proxy url %q", cfg.ProxyURL)
+		}
+
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	checkRedirect, err := redirectPolicy(cfg.RedirectPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt http.RoundTripper = transport
+	if cfg.UserAgent != "" {
+		rt = userAgentTransport{next: rt, userAgent: cfg.UserAgent}
+	}
+
+	return &http.Client{
+		Timeout:       cfg.Timeout,
+		Transport:     rt,
+		CheckRedirect: checkRedirect,
+	}, nil
+}
+
+// newTLSConfig returns the TLS configuration of cfg, or nil for the defaults.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.CABundle == "" && cfg.ClientCert == "" && cfg.ClientKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if cfg.CABundle != "" {
+		pem, err := ioutil.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidConfig, err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Wrapf(ErrInvalidConfig, "no certificate in ca bundle %s", cfg.CABundle)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, errors.Wrap(ErrInvalidConfig, "client cert and key must be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidConfig, err.Error())
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// redirectPolicy returns the CheckRedirect function of policy.
+func redirectPolicy(policy string) (func(*http.Request, []*http.Request) error, error) {
+	switch policy {
+	case "", RedirectFollow:
+		return nil, nil
+	case RedirectNone:
+		return func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}, nil
+	case RedirectSameHost:
+		return func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			if req.URL.Host != via[0].URL.Host {
+				return http.ErrUseLastResponse
+			}
+
+			return nil
+		}, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidConfig, "redirect policy %q", policy)
+	}
+}
+
+// userAgentTransport sets the User-Agent of the requests.
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+// RoundTrip sends req with the User-Agent.
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+
+	return t.next.RoundTrip(req)
+}
+
+// privateNetworks are the networks of RFC 1918, RFC 6598 and RFC 4193.
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fc00::/7"),
+}
+
+// blockPrivateNetworks refuses the connections to the addresses which are not
+// public.
+func blockPrivateNetworks(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Wrapf(ErrDestinationBlocked, "%s is not an ip address", host)
+	}
+
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return errors.Wrap(ErrDestinationBlocked, host)
+	}
+
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return errors.Wrap(ErrDestinationBlocked, host)
+		}
+	}
+
+	return nil
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+
+	return d
+}
+
+func intOr(n, def int) int {
+	if n == 0 {
+		return def
+	}
+
+	return n
+}
@@ -0,0 +1,141 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New_Defaults(t *testing.T) {
+	c, err := New(Config{Timeout: 3 * time.Second})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3*time.Second, c.Timeout)
+	assert.Nil(t, c.CheckRedirect)
+
+	tr := c.Transport.(*http.Transport)
+	assert.Equal(t, 5*time.Second, tr.TLSHandshakeTimeout)
+	assert.Equal(t, 50000, tr.MaxIdleConnsPerHost)
+	assert.Nil(t, tr.Proxy)
+	assert.Nil(t, tr.TLSClientConfig)
+}
+
+func Test_New_Invalid(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"proxy":    {ProxyURL: "::"},
+		"redirect": {RedirectPolicy: "sometimes"},
+		"key":      {ClientCert: "cert.pem"},
+		"ca":       {CABundle: "missing.pem"},
+		"blocked":  {BlockPrivateNetworks: true, ProxyURL: "http://proxy.example:3128"},
+	} {
+		_, err := New(cfg)
+		assert.Equal(t, ErrInvalidConfig, errors.Cause(err), name)
+	}
+}
+
+func Test_New_Blocks_Private_Networks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c, err := New(Config{BlockPrivateNetworks: true})
+	assert.NoError(t, err)
+
+	_, err = c.Get(srv.URL)
+	assert.True(t, errors.Is(err, ErrDestinationBlocked), err)
+}
+
+func Test_blockPrivateNetworks(t *testing.T) {
+	for address, blocked := range map[string]bool{
+		"127.0.0.1:80":       true,
+		"10.1.2.3:80":        true,
+		"172.20.0.1:443":     true,
+		"192.168.1.1:80":     true,
+		"169.254.169.254:80": true,
+		"0.0.0.0:80":         true,
+		"[::1]:80":           true,
+		"[fd00::1]:80":       true,
+		"[fe80::1]:80":       true,
+		"93.184.216.34:443":  false,
+		"172.32.0.1:443":     false,
+		"[2606:4700::1]:443": false,
+	} {
+		err := blockPrivateNetworks("tcp", address, nil)
+		assert.Equal(t, blocked, errors.Is(err, ErrDestinationBlocked), address)
+	}
+}
+
+func Test_New_Redirect_Policies(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, srv.URL+"/ok", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		policy string
+		path   string
+		code   int
+	}{
+		{RedirectFollow, "/other", http.StatusOK},
+		{RedirectNone, "/same", http.StatusFound},
+		{RedirectSameHost, "/same", http.StatusOK},
+		{RedirectSameHost, "/other", http.StatusFound},
+	}
+	for _, tt := range tests {
+		c, err := New(Config{RedirectPolicy: tt.policy})
+		assert.NoError(t, err)
+
+		r, err := c.Get(srv.URL + tt.path)
+		if assert.NoError(t, err) {
+			r.Body.Close()
+			assert.Equal(t, tt.code, r.StatusCode, tt.policy+" "+tt.path)
+		}
+	}
+}
+
+func Test_New_CABundle_And_UserAgent(t *testing.T) {
+	var agent string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.UserAgent()
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "client")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.NoError(t, ioutil.WriteFile(bundle, b, 0600))
+
+	// untrusted without the bundle
+	c, err := New(Config{})
+	assert.NoError(t, err)
+	_, err = c.Get(srv.URL)
+	assert.Error(t, err)
+
+	c, err = New(Config{CABundle: bundle, UserAgent: "notification-service"})
+	assert.NoError(t, err)
+
+	r, err := c.Get(srv.URL)
+	if assert.NoError(t, err) {
+		r.Body.Close()
+		assert.Equal(t, "notification-service", agent)
+	}
+}
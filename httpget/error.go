@@ -1,6 +1,30 @@
 package httpget
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
 
 // ErrsErrStatusCode is raised when request does not return 200
 var ErrStatusCode = errors.New("status code")
+
+// statusError is raised when request does not return 200. Its cause is ErrStatusCode.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d - %s: %s", e.code, e.status, ErrStatusCode)
+}
+
+// Cause returns ErrStatusCode.
+func (e *statusError) Cause() error {
+	return ErrStatusCode
+}
+
+// Unwrap returns ErrStatusCode.
+func (e *statusError) Unwrap() error {
+	return ErrStatusCode
+}
@@ -0,0 +1,23 @@
+package httpget
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/health"
+)
+
+// errPoolSaturated is reported while every runner is busy.
+var errPoolSaturated = errors.New("no free runner")
+
+// PoolCheck reports the state of the runner pool of w, failing while every runner is busy.
+func PoolCheck(w Worker) health.Check {
+	return func(context.Context) (interface{}, error) {
+		s := w.Pool()
+		if s.Free == 0 {
+			return s, errPoolSaturated
+		}
+
+		return s, nil
+	}
+}
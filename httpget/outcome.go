@@ -0,0 +1,79 @@
+package httpget
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vladimir-klymniuk/notification-service-original/httpclient"
+)
+
+// Outcome classes of a delivery attempt.
+const (
+	OutcomeTimeout           = "timeout"
+	OutcomeDNS               = "dns"
+	OutcomeConnectionRefused = "connection_refused"
+	OutcomeTLS               = "tls"
+	OutcomeBlocked           = "ssrf_blocked"
+	OutcomeError             = "error"
+)
+
+// Outcome returns the class of the result of a delivery attempt: the status
+// code class (2xx, 4xx, 5xx...) when the destination answered, otherwise the
+// kind of failure.
+func Outcome(err error) string {
+	if err == nil {
+		return "2xx"
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return strconv.Itoa(se.code/100) + "xx"
+	}
+
+	if errors.Is(err, httpclient.ErrDestinationBlocked) {
+		return OutcomeBlocked
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return OutcomeDNS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return OutcomeConnectionRefused
+	}
+
+	if isTLSError(err) {
+		return OutcomeTLS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return OutcomeTimeout
+	}
+
+	return OutcomeError
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostname),
+		errors.As(err, &invalid), errors.As(err, &recordHeader):
+		return true
+	}
+
+	return strings.Contains(err.Error(), "tls: ")
+}
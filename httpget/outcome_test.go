@@ -0,0 +1,46 @@
+package httpget
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/httpclient"
+)
+
+func TestOutcome(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com", Err: err}
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		expect string
+	}{
+		{name: "1 success", err: nil, expect: "2xx"},
+		{name: "2 client error", err: &statusError{code: 404, status: "404 Not Found"}, expect: "4xx"},
+		{name: "3 server error", err: &statusError{code: 503, status: "503 Service Unavailable"}, expect: "5xx"},
+		{name: "4 dns", err: urlErr(&net.DNSError{Err: "no such host", Name: "example.com"}), expect: OutcomeDNS},
+		{
+			name:   "5 connection refused",
+			err:    urlErr(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}),
+			expect: OutcomeConnectionRefused,
+		},
+		{name: "6 timeout", err: urlErr(context.DeadlineExceeded), expect: OutcomeTimeout},
+		{name: "7 tls", err: urlErr(errors.New("remote error: tls: handshake failure")), expect: OutcomeTLS},
+		{name: "8 blocked", err: urlErr(&net.OpError{Op: "dial", Err: errors.Wrap(httpclient.ErrDestinationBlocked, "10.0.0.1")}), expect: OutcomeBlocked},
+		{name: "9 other", err: errors.New("boom"), expect: OutcomeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, Outcome(tt.err))
+		})
+	}
+}
@@ -3,23 +3,61 @@ package httpget
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog/log"
 	"github.com/tkanos/konsumerou"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/inflight"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
 	"github.com/vladimir-klymniuk/notification-service-original/message"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+	"github.com/vladimir-klymniuk/notification-service-original/requestlog"
 	"github.com/vladimir-klymniuk/notification-service-original/runner"
+	"github.com/vladimir-klymniuk/notification-service-original/tracing"
 )
 
 // Worker processes messages.
 type Worker interface {
 	Process(context.Context, []byte) error
+	Pool() PoolState
+	// Stop waits for the tasks in flight to complete, and cancels them when
+	// ctx is done first. Process must not be called anymore.
+	Stop(ctx context.Context) error
+}
+
+// PoolState is the state of the runner pool.
+type PoolState struct {
+	Busy int `json:"busy"`
+	Free int `json:"free"`
 }
 
-// MakeWMakeWorkerEndpoint creates handler.
+// MakeWMakeWorkerEndpoint creates handler. The trace started by the
+// publisher of the message, and its request ID, are continued from the
+// record headers.
 func MakeWorkerEndpoint(s Worker) konsumerou.Handler {
 	return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		ctx = tracing.Extract(ctx, tracing.ConsumerCarrier(msg.Headers))
+
+		ctx, span := tracing.Tracer().Start(ctx, "consume "+msg.Topic,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination", msg.Topic),
+				attribute.Int64("messaging.kafka.partition", int64(msg.Partition)),
+				attribute.Int64("messaging.kafka.offset", msg.Offset),
+			),
+		)
+		defer span.End()
+
 		return s.Process(ctx, msg.Value)
 	}
 }
@@ -34,7 +72,7 @@ type Publisher interface {
 	Publish(context.Context, []byte) error
 }
 
-//
+// Builder creates runners.
 type Builder interface {
 	CreateRunner() runner.Runner
 }
@@ -44,24 +82,142 @@ type Decoder interface {
 	Decode(context.Context, []byte) (message.Message, error)
 }
 
+// Redactor masks secrets before they are logged or published.
+type Redactor interface {
+	URL(string) string
+	Header(http.Header) http.Header
+	Text(string) string
+}
+
+// Destination builds the URL of each notification, and the default headers
+// of its request.
+type Destination interface {
+	URL(message.Message) (string, error)
+	Header(message.Message) (http.Header, error)
+}
+
+// Auditor records delivery outcomes.
+type Auditor interface {
+	Record(context.Context, audit.Record)
+}
+
+// PoolObserver is notified of the use of the runner pool.
+type PoolObserver interface {
+	// Acquired is called when a runner is taken from the pool, after waiting for it.
+	Acquired(wait time.Duration)
+	// Released is called when a runner is put back to the pool.
+	Released()
+}
+
+type nopPoolObserver struct{}
+
+func (nopPoolObserver) Acquired(time.Duration) {}
+func (nopPoolObserver) Released()              {}
+
+// DeliveryObserver is notified of the outcome of deliveries, as classified by Outcome.
+type DeliveryObserver interface {
+	// Attempted is called after each attempt.
+	Attempted(host, outcome string)
+	// Completed is called with the final outcome, and the time elapsed since
+	// the message was accepted when known.
+	Completed(host, outcome string, latency time.Duration)
+}
+
+type nopDeliveryObserver struct{}
+
+func (nopDeliveryObserver) Attempted(string, string)                {}
+func (nopDeliveryObserver) Completed(string, string, time.Duration) {}
+
 type worker struct {
 	runners      chan runner.Runner
 	decoder      Decoder
 	sender       Sender
 	rbuilder     Builder
 	errPublisher Publisher
+	redactor     Redactor
+	destination  Destination
+	auditor      Auditor
+	tenantID     string
+	service      string
+	pool         PoolObserver
+	delivery     DeliveryObserver
+	registry     *inflight.Registry
+	regService   string
+	// done is cancelled when the worker is stopped
+	done   context.Context
+	cancel context.CancelFunc
+}
+
+// Option modifies worker. Used in NewWorker.
+type Option func(*worker)
+
+// WithRedactor sets the redactor applied to logged and dead-lettered URLs.
+func WithRedactor(r Redactor) Option {
+	return func(w *worker) {
+		w.redactor = r
+	}
+}
+
+// WithDestination sets the destination building the URLs of the
+// notifications sent with a path or variables.
+func WithDestination(d Destination) Option {
+	return func(w *worker) {
+		w.destination = d
+	}
+}
+
+// WithAuditor sets the auditor recording the final outcome of each delivery
+// of the given tenant and service.
+func WithAuditor(a Auditor, tenantID, service string) Option {
+	return func(w *worker) {
+		w.auditor = a
+		w.tenantID = tenantID
+		w.service = service
+	}
+}
+
+// WithPoolObserver sets the observer of the runner pool.
+func WithPoolObserver(o PoolObserver) Option {
+	return func(w *worker) {
+		w.pool = o
+	}
+}
+
+// WithDeliveryObserver sets the observer of delivery outcomes.
+func WithDeliveryObserver(o DeliveryObserver) Option {
+	return func(w *worker) {
+		w.delivery = o
+	}
+}
+
+// WithRegistry registers the tasks in flight of service in r.
+func WithRegistry(r *inflight.Registry, service string) Option {
+	return func(w *worker) {
+		w.registry = r
+		w.regService = service
+	}
 }
 
 // NewWorker creates worker.
-func NewWorker(sender Sender, errPublisher Publisher, decoder Decoder, number int, builder Builder) Worker {
+func NewWorker(sender Sender, errPublisher Publisher, decoder Decoder, number int, builder Builder, options ...Option) Worker {
 	w := &worker{
 		sender:       sender,
 		decoder:      decoder,
 		rbuilder:     builder,
 		errPublisher: errPublisher,
+		redactor:     redact.Default(),
+		destination:  destination.Default(),
+		auditor:      audit.Nop(),
+		pool:         nopPoolObserver{},
+		delivery:     nopDeliveryObserver{},
+	}
+
+	for _, option := range options {
+		option(w)
 	}
 
 	w.runners = createRunners(w.rbuilder, number)
+	w.done, w.cancel = context.WithCancel(context.Background())
 
 	return w
 }
@@ -70,49 +226,186 @@ func NewWorker(sender Sender, errPublisher Publisher, decoder Decoder, number in
 func (w *worker) Process(ctx context.Context, msg []byte) error {
 	m, err := w.decoder.Decode(ctx, msg)
 	if err != nil {
-		log.Error().Err(err).Bytes("data", msg).Msg("unable to decode message")
+		requestlog.With(ctx, logging.For("httpget")).Error().Err(err).Str("data", w.redactor.Text(string(msg))).Msg("unable to decode message")
 		return err
 	}
 
-	log.Info().Msgf("process: %s", string(msg))
+	requestlog.With(ctx, logging.Sampled("httpget")).Info().Msgf("process: %s", w.redactor.Text(string(msg)))
+
+	u, err := w.destination.URL(m)
+	var header http.Header
+	if err == nil {
+		header, err = w.destination.Header(m)
+	}
+
+	if err != nil {
+		requestlog.With(ctx, logging.For("httpget")).Error().Str("error", w.redactor.Text(err.Error())).Msg("unable to build the request")
+
+		w.logError(ctx, errors.Wrapf(err, "request: %s", m.ID))
+		w.audit(ctx, m, "", 0, err)
+		w.complete(m, "", err)
+
+		return nil
+	}
 
 	// get free runner
+	start := time.Now()
 	r := <-w.runners
+	w.pool.Acquired(time.Since(start))
+
+	// retries outlive the consumer of the message, until the worker is stopped
+	ctx = taskContext{Context: w.done, values: ctx}
 
 	go func(ctx context.Context, r runner.Runner) {
+		entry := w.registry.Start(w.regService, m.ID, hostname(u))
+		ctx = inflight.NewContext(ctx, entry)
+
 		// put sender back to queue
 		defer func() {
+			entry.Done()
+			w.pool.Released()
 			w.runners <- r
 		}()
 
 		// create Task
-		task := w.createTask(m.HTTPRequest)
+		task := w.createTask(ctx, u, header)
 		// execute task
 		n, err := r.Execute(ctx, task)
 		if err != nil {
-			log.Error().Err(err).Int("attempt", n).Msg(m.HTTPRequest)
+			dest := w.redactor.URL(u)
 
-			w.logError(ctx, errors.Wrapf(err, "request: %s : attempt: %d ", m.HTTPRequest, n))
+			requestlog.With(ctx, logging.For("httpget")).Error().Str("error", w.redactor.Text(err.Error())).Int("attempt", n).Msg(dest)
+
+			w.logError(ctx, errors.Wrapf(err, "request: %s : attempt: %d ", dest, n))
 		}
+
+		w.audit(ctx, m, u, n, err)
+		w.complete(m, u, err)
 	}(ctx, r)
 
 	return nil
 }
 
-// logError logs error.
+// Stop waits for the tasks in flight to complete, and cancels them when ctx is
+// done first.
+func (w *worker) Stop(ctx context.Context) error {
+	var err error
+
+	for i := 0; i < cap(w.runners); i++ {
+		select {
+		case <-w.runners:
+		case <-ctx.Done():
+			err = ctx.Err()
+			w.cancel()
+			<-w.runners
+		}
+	}
+
+	w.cancel()
+
+	return err
+}
+
+// taskContext carries the values of the context of a message, such as its
+// trace, but is only cancelled with the worker.
+type taskContext struct {
+	context.Context
+	values context.Context
+}
+
+// Value returns the value of the message context for key.
+func (c taskContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// complete reports the final outcome of the delivery of m to url.
+func (w *worker) complete(m message.Message, url string, err error) {
+	var latency time.Duration
+	if !m.AcceptedAt.IsZero() {
+		latency = time.Since(m.AcceptedAt)
+	}
+
+	w.delivery.Completed(hostname(url), Outcome(err), latency)
+}
+
+// hostname returns the host of rawurl, or "" when it cannot be parsed.
+func hostname(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// Pool returns the state of the runner pool.
+func (w *worker) Pool() PoolState {
+	free := len(w.runners)
+
+	return PoolState{
+		Busy: cap(w.runners) - free,
+		Free: free,
+	}
+}
+
+// audit records the final outcome of the delivery of m to url.
+func (w *worker) audit(ctx context.Context, m message.Message, url string, n int, err error) {
+	rec := audit.Record{
+		Event:           audit.EventDelivery,
+		NotificationID:  m.ID,
+		TenantID:        w.tenantID,
+		Service:         w.service,
+		Decision:        audit.DecisionDelivered,
+		DestinationHost: hostname(url),
+		Attempts:        n + 1,
+	}
+
+	if err != nil {
+		rec.Decision = audit.DecisionFailed
+		rec.Reason = w.redactor.Text(err.Error())
+		rec.Attempts = n
+	}
+
+	w.auditor.Record(ctx, rec)
+}
+
+// logError publishes error to the error topic, with any URL it contains redacted.
 func (w *worker) logError(ctx context.Context, err error) {
-	b := []byte(err.Error())
+	b := []byte(w.redactor.Text(err.Error()))
 
 	err = w.errPublisher.Publish(ctx, b)
 	if err != nil {
-		log.Error().Err(err).Msg("unable to log error")
+		requestlog.With(ctx, logging.For("httpget")).Error().Err(err).Msg("unable to log error")
 	}
 }
 
-// createTask creates task to execute.
-func (w *worker) createTask(url string) func() error {
+// createTask creates task to execute, sending header with each request. Each
+// attempt is traced as a child of ctx.
+func (w *worker) createTask(ctx context.Context, url string, header http.Header) func() error {
+	attempt := 0
+
 	return func() error {
-		return send(w.sender, url)
+		attempt++
+		inflight.FromContext(ctx).Attempt(attempt)
+
+		ctx, span := tracing.Tracer().Start(ctx, "attempt", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		defer span.End()
+
+		event := requestlog.With(ctx, logging.Sampled("httpget")).Info()
+		if len(header) > 0 {
+			event = event.Interface("header", w.redactor.Header(header))
+		}
+
+		event.Msgf("http GET: %s", w.redactor.URL(url))
+
+		err := send(ctx, w.sender, w.redactor, url, header)
+		if err != nil {
+			span.SetStatus(codes.Error, w.redactor.Text(err.Error()))
+		}
+
+		w.delivery.Attempted(hostname(url), Outcome(err))
+
+		return err
 	}
 }
 
@@ -127,27 +420,53 @@ func createRunners(b Builder, number int) chan runner.Runner {
 	return runners
 }
 
-// send sends GET request to url.
-func send(sender Sender, url string) error {
-	log.Info().Msgf("http GET: %s", url)
-
-	req, err := http.NewRequest("GET", url, nil)
+// send sends GET request to url with header, and the trace context and request
+// ID of ctx. Failures are recorded on the span of the request, redacted by r.
+func send(ctx context.Context, sender Sender, r Redactor, url string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
 
-	r, err := sender.Do(req)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "http GET",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("net.peer.name", req.URL.Hostname())),
+	)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := sender.Do(req)
 	if err != nil {
+		recordError(span, r, err)
 		return err
 	}
 
 	// close body
-	r.Body.Close()
+	resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
 	// check status code for 200 OK
-	if r.StatusCode != http.StatusOK {
-		return errors.Wrapf(ErrStatusCode, "%d - %s", r.StatusCode, r.Status)
+	if resp.StatusCode != http.StatusOK {
+		err = &statusError{code: resp.StatusCode, status: resp.Status}
+		recordError(span, r, err)
+
+		return err
 	}
 
 	return nil
 }
+
+// recordError marks span as failed with err, redacted by r.
+func recordError(span trace.Span, r Redactor, err error) {
+	msg := r.Text(err.Error())
+
+	span.RecordError(errors.New(msg))
+	span.SetStatus(codes.Error, msg)
+}
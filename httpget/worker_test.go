@@ -5,12 +5,25 @@ import (
 	"context"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/message"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+	"github.com/vladimir-klymniuk/notification-service-original/runner"
 )
 
 type mockSender struct {
@@ -42,7 +55,7 @@ func Test_send(t *testing.T) {
 	s := &mockSender{}
 	s.On("Do", mock.Anything).Return(r, nil)
 
-	err := send(s, url)
+	err := send(context.Background(), s, redact.Default(), url, nil)
 
 	assert.Nil(t, err)
 }
@@ -50,7 +63,7 @@ func Test_send(t *testing.T) {
 func Test_send_Should_Return_Err_When_Unable_Create_Request(t *testing.T) {
 	url := ":"
 
-	err := send(nil, url)
+	err := send(context.Background(), nil, redact.Default(), url, nil)
 
 	assert.NotNil(t, err)
 
@@ -64,7 +77,7 @@ func Test_send_Should_Return_Err_When_Request_Fails(t *testing.T) {
 	s := &mockSender{}
 	s.On("Do", mock.Anything).Return((*http.Response)(nil), errors.New("unable to send request"))
 
-	err := send(s, url)
+	err := send(context.Background(), s, redact.Default(), url, nil)
 
 	assert.EqualError(t, err, "unable to send request")
 }
@@ -80,15 +93,188 @@ func Test_send_Should_Return_Err_When_Response_Code_Is_Not_OK(t *testing.T) {
 	s := &mockSender{}
 	s.On("Do", mock.Anything).Return(r, nil)
 
-	err := send(s, url)
+	err := send(context.Background(), s, redact.Default(), url, nil)
 
 	assert.EqualError(t, err, "0 - : status code")
 }
 
+func Test_send_Should_Record_The_Error_On_The_Span(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(previous)
+
+	s := &mockSender{}
+	s.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusBadGateway,
+		Status:     "502 Bad Gateway",
+		Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+	}, nil)
+
+	assert.Error(t, send(context.Background(), s, redact.Default(), "http://example.com/cb?token=secret", nil))
+
+	spans := sr.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Equal(t, "502 - 502 Bad Gateway: status code", spans[0].Status().Description)
+		assert.Len(t, spans[0].Events(), 1)
+	}
+}
+
 func Test_createTask(t *testing.T) {
 	w := &worker{}
 
-	f := w.createTask("url")
+	f := w.createTask(context.Background(), "url", nil)
 
 	assert.NotNil(t, f)
-}
\ No newline at end of file
+}
+
+func Test_createTask_Logs_The_Header_Redacted(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+
+	s := &mockSender{}
+	s.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil)
+
+	w := &worker{sender: s, redactor: redact.Default(), delivery: nopDeliveryObserver{}}
+
+	header := http.Header{"Authorization": {"Bearer secret"}, "X-Partner": {"p"}}
+	assert.NoError(t, w.createTask(context.Background(), "http://example.com/cb", header)())
+
+	out := buf.String()
+	assert.Contains(t, out, `"Authorization":["REDACTED"]`)
+	assert.Contains(t, out, `"X-Partner":["p"]`)
+	assert.NotContains(t, out, "secret")
+
+	req := s.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+}
+
+// blockingSender answers once released, or fails when the request is cancelled.
+type blockingSender struct {
+	release chan struct{}
+	// answers counts the calls which returned
+	answers int32
+}
+
+func (s *blockingSender) Do(r *http.Request) (*http.Response, error) {
+	defer atomic.AddInt32(&s.answers, 1)
+
+	select {
+	case <-s.release:
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+}
+
+func newStopWorker(t *testing.T, sender Sender) (Worker, []byte) {
+	p := &mockPublisher{}
+	p.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	w := NewWorker(sender, p, message.NewDecoder(), 1, runner.NewBuilder(1, time.Millisecond))
+
+	b, err := message.NewEncoder().Encode(context.Background(), message.Message{
+		ID:          "id",
+		Type:        message.TypeHTTPGet,
+		HTTPRequest: "http://example.com/cb",
+	})
+	assert.NoError(t, err)
+
+	return w, b
+}
+
+func Test_worker_Stop_Waits_For_Tasks_In_Flight(t *testing.T) {
+	sender := &blockingSender{release: make(chan struct{})}
+	w, b := newStopWorker(t, sender)
+
+	// the task outlives the context of the consumed message
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, w.Process(ctx, b))
+	cancel()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(sender.release)
+	}()
+
+	assert.NoError(t, w.Stop(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&sender.answers))
+}
+
+func Test_worker_Stop_Cancels_Tasks_When_Draining_Times_Out(t *testing.T) {
+	sender := &blockingSender{release: make(chan struct{})}
+	w, b := newStopWorker(t, sender)
+
+	assert.NoError(t, w.Process(context.Background(), b))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, w.Stop(ctx))
+}
+
+func Test_worker_Process_Builds_The_URL_From_The_Destination(t *testing.T) {
+	s := &mockSender{}
+	s.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil)
+
+	d, err := destination.New(destination.Config{
+		BaseURL: "https://partner.example/api",
+		Headers: map[string]func() (string, error){"authorization": func() (string, error) { return "Bearer t", nil }},
+	})
+	assert.NoError(t, err)
+
+	w := NewWorker(s, &mockPublisher{}, message.NewDecoder(), 1, runner.NewBuilder(1, time.Millisecond), WithDestination(d))
+
+	b, err := message.NewEncoder().Encode(context.Background(), message.Message{ID: "id", Type: message.TypeHTTPGet, Path: "orders/1"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Process(context.Background(), b))
+	assert.NoError(t, w.Stop(context.Background()))
+
+	req := s.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "https://partner.example/api/orders/1", req.URL.String())
+	assert.Equal(t, "Bearer t", req.Header.Get("Authorization"))
+}
+
+func Test_worker_Process_Logs_The_Message_Redacted(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+
+	s := &mockSender{}
+	s.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil)
+
+	w := NewWorker(s, &mockPublisher{}, message.NewDecoder(), 1, runner.NewBuilder(1, time.Millisecond), WithRedactor(redact.Default()))
+
+	b, err := message.NewEncoder().Encode(context.Background(), message.Message{
+		ID:          "id",
+		Type:        message.TypeHTTPGet,
+		HTTPRequest: "http://example.com/cb?a=1&token=secret1&api_key=secret2",
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Process(context.Background(), b))
+	assert.NoError(t, w.Stop(context.Background()))
+
+	out := buf.String()
+	assert.Contains(t, out, "process: ")
+	assert.NotContains(t, out, "secret1")
+	assert.NotContains(t, out, "secret2")
+}
+
+func Test_worker_Process_Publishes_The_Error_When_The_URL_Cannot_Be_Built(t *testing.T) {
+	p := &mockPublisher{}
+	p.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	w := NewWorker(&mockSender{}, p, message.NewDecoder(), 1, runner.NewBuilder(1, time.Millisecond))
+
+	b, err := message.NewEncoder().Encode(context.Background(), message.Message{ID: "id", Type: message.TypeHTTPGet, Path: "orders/1"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Process(context.Background(), b))
+	assert.NoError(t, w.Stop(context.Background()))
+
+	p.AssertCalled(t, "Publish", mock.Anything, []byte("request: id: no http_request and no destination"))
+}
@@ -0,0 +1,177 @@
+// Package inflight keeps track of the tasks being executed by the workers,
+// so that they can be inspected while the service runs.
+package inflight
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of a task
+const (
+	StateRunning  = "running"
+	StateSleeping = "sleeping"
+)
+
+// Task describes a task in flight.
+type Task struct {
+	Service         string     `json:"service"`
+	NotificationID  string     `json:"notification_id"`
+	DestinationHost string     `json:"destination_host"`
+	State           string     `json:"state"`
+	Attempt         int        `json:"attempt"`
+	Started         time.Time  `json:"started"`
+	NextRetry       *time.Time `json:"next_retry,omitempty"`
+}
+
+// Registry holds the tasks in flight. The zero value is not usable, a nil
+// Registry tracks nothing.
+type Registry struct {
+	mu    sync.Mutex
+	next  uint64
+	tasks map[uint64]*Task
+	now   func() time.Time
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		tasks: make(map[uint64]*Task),
+		now:   time.Now,
+	}
+}
+
+// Start registers a task of service delivering notificationID to host.
+// The returned Entry is updated as the task progresses, and must be ended
+// with Done.
+func (r *Registry) Start(service, notificationID, host string) *Entry {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next++
+	r.tasks[r.next] = &Task{
+		Service:         service,
+		NotificationID:  notificationID,
+		DestinationHost: host,
+		State:           StateRunning,
+		Started:         r.now(),
+	}
+
+	return &Entry{registry: r, id: r.next}
+}
+
+// Tasks returns the tasks in flight, oldest first.
+func (r *Registry) Tasks() []Task {
+	r.mu.Lock()
+	tasks := make([]Task, 0, len(r.tasks))
+	for _, t := range r.tasks {
+		tasks = append(tasks, *t)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Started.Before(tasks[j].Started)
+	})
+
+	return tasks
+}
+
+// Report lists the tasks in flight of each service.
+type Report struct {
+	Running  int               `json:"running"`
+	Sleeping int               `json:"sleeping"`
+	Services map[string][]Task `json:"services"`
+}
+
+// Handler lists the tasks in flight by service; the service query parameter
+// restricts the list to one service.
+func (r *Registry) Handler(w http.ResponseWriter, req *http.Request) {
+	service := req.URL.Query().Get("service")
+
+	report := Report{Services: make(map[string][]Task)}
+
+	for _, t := range r.Tasks() {
+		if service != "" && t.Service != service {
+			continue
+		}
+
+		if t.State == StateSleeping {
+			report.Sleeping++
+		} else {
+			report.Running++
+		}
+
+		report.Services[t.Service] = append(report.Services[t.Service], t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Entry updates a task of the Registry. Methods of a nil Entry do nothing.
+type Entry struct {
+	registry *Registry
+	id       uint64
+}
+
+func (e *Entry) update(f func(*Task)) {
+	if e == nil {
+		return
+	}
+
+	e.registry.mu.Lock()
+	defer e.registry.mu.Unlock()
+
+	if t, ok := e.registry.tasks[e.id]; ok {
+		f(t)
+	}
+}
+
+// Attempt records that attempt n started.
+func (e *Entry) Attempt(n int) {
+	e.update(func(t *Task) {
+		t.State = StateRunning
+		t.Attempt = n
+		t.NextRetry = nil
+	})
+}
+
+// Sleeping records that the task waits until next before its next attempt.
+func (e *Entry) Sleeping(next time.Time) {
+	e.update(func(t *Task) {
+		t.State = StateSleeping
+		t.NextRetry = &next
+	})
+}
+
+// Done removes the task from the Registry.
+func (e *Entry) Done() {
+	if e == nil {
+		return
+	}
+
+	e.registry.mu.Lock()
+	delete(e.registry.tasks, e.id)
+	e.registry.mu.Unlock()
+}
+
+type entryKey struct{}
+
+// NewContext returns ctx carrying e.
+func NewContext(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// FromContext returns the Entry carried by ctx, or nil.
+func FromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(entryKey{}).(*Entry)
+	return e
+}
@@ -0,0 +1,82 @@
+package inflight
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Registry_Tracks_Task_Progress(t *testing.T) {
+	r := NewRegistry()
+	now := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	e := r.Start("ssp", "n1", "example.com")
+	e.Attempt(1)
+
+	next := now.Add(time.Second)
+	e.Sleeping(next)
+
+	tasks := r.Tasks()
+	assert.Equal(t, []Task{{
+		Service:         "ssp",
+		NotificationID:  "n1",
+		DestinationHost: "example.com",
+		State:           StateSleeping,
+		Attempt:         1,
+		Started:         now,
+		NextRetry:       &next,
+	}}, tasks)
+
+	e.Attempt(2)
+	tasks = r.Tasks()
+	assert.Equal(t, StateRunning, tasks[0].State)
+	assert.Equal(t, 2, tasks[0].Attempt)
+	assert.Nil(t, tasks[0].NextRetry)
+
+	e.Done()
+	assert.Empty(t, r.Tasks())
+}
+
+func Test_Nil_Registry_And_Entry(t *testing.T) {
+	var r *Registry
+
+	e := r.Start("ssp", "n1", "example.com")
+	assert.Nil(t, e)
+
+	e.Attempt(1)
+	e.Sleeping(time.Now())
+	e.Done()
+
+	assert.Nil(t, FromContext(context.Background()))
+}
+
+func Test_Handler_Groups_By_Service(t *testing.T) {
+	r := NewRegistry()
+	r.Start("ssp", "n1", "a.example.com").Attempt(1)
+	r.Start("dsp", "n2", "b.example.com").Sleeping(time.Now())
+
+	rec := httptest.NewRecorder()
+	r.Handler(rec, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+
+	var report Report
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.Equal(t, 1, report.Running)
+	assert.Equal(t, 1, report.Sleeping)
+	assert.Len(t, report.Services["ssp"], 1)
+	assert.Len(t, report.Services["dsp"], 1)
+
+	rec = httptest.NewRecorder()
+	r.Handler(rec, httptest.NewRequest(http.MethodGet, "/tasks?service=dsp", nil))
+
+	report = Report{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.Equal(t, 0, report.Running)
+	assert.Len(t, report.Services, 1)
+	assert.Equal(t, "n2", report.Services["dsp"][0].NotificationID)
+}
@@ -0,0 +1,208 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// Initial offsets of a consumer group without committed offsets
+const (
+	OffsetNewest = "newest"
+	OffsetOldest = "oldest"
+)
+
+// Acknowledgements required by the producer
+const (
+	AcksNone  = "none"
+	AcksLocal = "local"
+	AcksAll   = "all"
+)
+
+// ErrInvalidClientConfig is raised when the kafka client cannot be configured.
+var ErrInvalidClientConfig = errors.New("invalid kafka client config")
+
+// ClientConfig configures the kafka clients. Zero values keep the sarama
+// defaults.
+type ClientConfig struct {
+	// Version of the brokers, e.g. "2.4.0"
+	Version string
+	// ClientID identifying this instance to the brokers
+	ClientID string
+	// MetadataRefresh is the period of the refresh of the cluster metadata
+	MetadataRefresh time.Duration
+	// SASL/SCRAM-SHA-512 credentials, Password is called on each authentication
+	Username string
+	Password func() (string, error)
+
+	Consumer ConsumerConfig
+	Producer ProducerConfig
+}
+
+// ConsumerConfig configures the consumer groups.
+type ConsumerConfig struct {
+	// InitialOffset is OffsetNewest or OffsetOldest
+	InitialOffset string
+	// RebalanceStrategy is "range", "roundrobin" or "sticky"
+	RebalanceStrategy string
+	SessionTimeout    time.Duration
+	HeartbeatInterval time.Duration
+	CommitInterval    time.Duration
+	// Fetch sizes in bytes
+	FetchMin     int32
+	FetchDefault int32
+	FetchMax     int32
+}
+
+// ProducerConfig configures the producers.
+type ProducerConfig struct {
+	// RequiredAcks is AcksNone, AcksLocal or AcksAll
+	RequiredAcks string
+	// Compression is "none", "gzip", "snappy", "lz4" or "zstd"
+	Compression     string
+	FlushFrequency  time.Duration
+	FlushBytes      int
+	FlushMessages   int
+	MaxMessageBytes int
+}
+
+// NewConfig returns the sarama configuration of cfg, validated.
+func NewConfig(cfg ClientConfig) (*sarama.Config, error) {
+	c := sarama.NewConfig()
+
+	if cfg.Version != "" {
+		v, err := sarama.ParseKafkaVersion(cfg.Version)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidClientConfig, "version %q", cfg.Version)
+		}
+
+		c.Version = v
+	}
+
+	if cfg.ClientID != "" {
+		c.ClientID = cfg.ClientID
+	}
+
+	if cfg.MetadataRefresh != 0 {
+		c.Metadata.RefreshFrequency = cfg.MetadataRefresh
+	}
+
+	if cfg.Password != nil {
+		password, err := cfg.Password()
+		if err != nil {
+			return nil, errors.Wrap(err, "kafka password")
+		}
+
+		c.Net.SASL.Enable = true
+		c.Net.SASL.User = cfg.Username
+		c.Net.SASL.Password = password
+		c.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		c.Net.SASL.Handshake = true
+		c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &XDGSCRAMClient{HashGeneratorFcn: SHA512, PasswordFunc: cfg.Password}
+		}
+	}
+
+	if err := applyConsumer(c, cfg.Consumer); err != nil {
+		return nil, err
+	}
+
+	if err := applyProducer(c, cfg.Producer); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrap(ErrInvalidClientConfig, err.Error())
+	}
+
+	return c, nil
+}
+
+func applyConsumer(c *sarama.Config, cfg ConsumerConfig) error {
+	switch cfg.InitialOffset {
+	case "", OffsetNewest:
+		c.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case OffsetOldest:
+		c.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return errors.Wrapf(ErrInvalidClientConfig, "initial offset %q", cfg.InitialOffset)
+	}
+
+	switch cfg.RebalanceStrategy {
+	case "", sarama.RangeBalanceStrategyName:
+		c.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
+	case sarama.RoundRobinBalanceStrategyName:
+		c.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
+	case sarama.StickyBalanceStrategyName:
+		c.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategySticky
+	default:
+		return errors.Wrapf(ErrInvalidClientConfig, "rebalance strategy %q", cfg.RebalanceStrategy)
+	}
+
+	if cfg.SessionTimeout != 0 {
+		c.Consumer.Group.Session.Timeout = cfg.SessionTimeout
+	}
+
+	if cfg.HeartbeatInterval != 0 {
+		c.Consumer.Group.Heartbeat.Interval = cfg.HeartbeatInterval
+	}
+
+	if cfg.CommitInterval != 0 {
+		c.Consumer.Offsets.CommitInterval = cfg.CommitInterval
+	}
+
+	if cfg.FetchMin != 0 {
+		c.Consumer.Fetch.Min = cfg.FetchMin
+	}
+
+	if cfg.FetchDefault != 0 {
+		c.Consumer.Fetch.Default = cfg.FetchDefault
+	}
+
+	c.Consumer.Fetch.Max = cfg.FetchMax
+
+	if c.Consumer.Group.Heartbeat.Interval >= c.Consumer.Group.Session.Timeout {
+		return errors.Wrap(ErrInvalidClientConfig, "heartbeat interval must be lower than the session timeout")
+	}
+
+	return nil
+}
+
+func applyProducer(c *sarama.Config, cfg ProducerConfig) error {
+	switch cfg.RequiredAcks {
+	case "", AcksLocal:
+		c.Producer.RequiredAcks = sarama.WaitForLocal
+	case AcksNone:
+		c.Producer.RequiredAcks = sarama.NoResponse
+	case AcksAll:
+		c.Producer.RequiredAcks = sarama.WaitForAll
+	default:
+		return errors.Wrapf(ErrInvalidClientConfig, "required acks %q", cfg.RequiredAcks)
+	}
+
+	switch cfg.Compression {
+	case "", "none":
+		c.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		c.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		c.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		c.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		c.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return errors.Wrapf(ErrInvalidClientConfig, "compression %q", cfg.Compression)
+	}
+
+	c.Producer.Flush.Frequency = cfg.FlushFrequency
+	c.Producer.Flush.Bytes = cfg.FlushBytes
+	c.Producer.Flush.Messages = cfg.FlushMessages
+
+	if cfg.MaxMessageBytes != 0 {
+		c.Producer.MaxMessageBytes = cfg.MaxMessageBytes
+	}
+
+	return nil
+}
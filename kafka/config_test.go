@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewConfig_Defaults(t *testing.T) {
+	c, err := NewConfig(ClientConfig{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, sarama.OffsetNewest, c.Consumer.Offsets.Initial)
+	assert.Equal(t, sarama.BalanceStrategyRange, c.Consumer.Group.Rebalance.Strategy)
+	assert.Equal(t, sarama.WaitForLocal, c.Producer.RequiredAcks)
+	assert.Equal(t, sarama.CompressionNone, c.Producer.Compression)
+	assert.False(t, c.Net.SASL.Enable)
+}
+
+func Test_NewConfig(t *testing.T) {
+	c, err := NewConfig(ClientConfig{
+		Version:  "2.4.0",
+		ClientID: "notification-service-host1",
+		Username: "notification-service",
+		Password: func() (string, error) { return "secret", nil },
+		Consumer: ConsumerConfig{
+			InitialOffset:     OffsetOldest,
+			RebalanceStrategy: "sticky",
+			SessionTimeout:    30 * time.Second,
+			CommitInterval:    5 * time.Second,
+			FetchMax:          10 << 20,
+		},
+		Producer: ProducerConfig{
+			RequiredAcks:   AcksAll,
+			Compression:    "zstd",
+			FlushFrequency: 50 * time.Millisecond,
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, sarama.V2_4_0_0, c.Version)
+	assert.Equal(t, "notification-service-host1", c.ClientID)
+	assert.True(t, c.Net.SASL.Enable)
+	assert.Equal(t, "secret", c.Net.SASL.Password)
+	assert.Equal(t, sarama.OffsetOldest, c.Consumer.Offsets.Initial)
+	assert.Equal(t, sarama.BalanceStrategySticky, c.Consumer.Group.Rebalance.Strategy)
+	assert.Equal(t, 30*time.Second, c.Consumer.Group.Session.Timeout)
+	assert.Equal(t, 5*time.Second, c.Consumer.Offsets.CommitInterval)
+	assert.Equal(t, int32(10<<20), c.Consumer.Fetch.Max)
+	assert.Equal(t, sarama.WaitForAll, c.Producer.RequiredAcks)
+	assert.Equal(t, sarama.CompressionZSTD, c.Producer.Compression)
+	assert.Equal(t, 50*time.Millisecond, c.Producer.Flush.Frequency)
+}
+
+func Test_NewConfig_Invalid(t *testing.T) {
+	for name, cfg := range map[string]ClientConfig{
+		"version":   {Version: "2.x"},
+		"client id": {ClientID: "a b"},
+		"offset":    {Consumer: ConsumerConfig{InitialOffset: "latest"}},
+		"strategy":  {Consumer: ConsumerConfig{RebalanceStrategy: "random"}},
+		"heartbeat": {Consumer: ConsumerConfig{SessionTimeout: time.Second, HeartbeatInterval: 2 * time.Second}},
+		"fetch":     {Consumer: ConsumerConfig{FetchMax: -1}},
+		"acks":      {Producer: ProducerConfig{RequiredAcks: "some"}},
+		"codec":     {Producer: ProducerConfig{Compression: "brotli"}},
+		"zstd":      {Version: "1.0.0", Producer: ProducerConfig{Compression: "zstd"}},
+	} {
+		_, err := NewConfig(cfg)
+		assert.Equal(t, ErrInvalidClientConfig, errors.Cause(err), name)
+	}
+}
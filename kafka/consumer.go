@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/tkanos/konsumerou"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+// Consume consumes topics with group until ctx is done, calling handler for
+// each message and marking it once handled. Unlike konsumerou, the group is
+// built by the caller, which closes the client of the group after it.
+func Consume(ctx context.Context, group sarama.ConsumerGroup, topics []string, handler konsumerou.Handler) {
+	for {
+		if err := group.Consume(ctx, topics, groupHandler{ctx: ctx, handler: handler}); err != nil {
+			if err == sarama.ErrClosedConsumerGroup {
+				return
+			}
+
+			logging.For("kafka").Error().Err(err).Strs("topics", topics).Msg("unable to consume")
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// groupHandler calls handler for the messages of the claims.
+type groupHandler struct {
+	ctx     context.Context
+	handler konsumerou.Handler
+}
+
+func (groupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (groupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		// the handler logs its errors, and publishes them to the error topic
+		_ = h.handler(h.ctx, msg)
+
+		session.MarkMessage(msg, "")
+	}
+
+	return nil
+}
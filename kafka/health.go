@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/vladimir-klymniuk/notification-service-original/health"
+)
+
+// BrokerCheck checks that the brokers are reachable and serve the metadata of topics.
+func BrokerCheck(client sarama.Client, topics ...string) health.Check {
+	return func(context.Context) (interface{}, error) {
+		if err := client.RefreshMetadata(topics...); err != nil {
+			return nil, err
+		}
+
+		connected := 0
+		for _, b := range client.Brokers() {
+			if ok, _ := b.Connected(); ok {
+				connected++
+			}
+		}
+
+		return map[string]int{
+			"brokers":   len(client.Brokers()),
+			"connected": connected,
+		}, nil
+	}
+}
+
+// GroupMemberCheck checks that the consumer group is stable and that this
+// instance, identified by clientID, is one of its members.
+func GroupMemberCheck(admin sarama.ClusterAdmin, group, clientID string) health.Check {
+	return func(context.Context) (interface{}, error) {
+		groups, err := admin.DescribeConsumerGroups([]string{group})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("group %s not found", group)
+		}
+
+		g := groups[0]
+		if g.Err != sarama.ErrNoError {
+			return nil, g.Err
+		}
+
+		details := map[string]interface{}{
+			"state":   g.State,
+			"members": len(g.Members),
+		}
+
+		assigned := map[string][]int32{}
+		member := false
+
+		for _, m := range g.Members {
+			if m.ClientId != clientID {
+				continue
+			}
+
+			member = true
+
+			if a, err := m.GetMemberAssignment(); err == nil && a != nil {
+				for topic, ps := range a.Topics {
+					assigned[topic] = append(assigned[topic], ps...)
+				}
+			}
+		}
+
+		details["assigned"] = assigned
+
+		if g.State != "Stable" {
+			return details, fmt.Errorf("group %s is %s", group, g.State)
+		}
+
+		if !member {
+			return details, fmt.Errorf("not a member of group %s", group)
+		}
+
+		return details, nil
+	}
+}
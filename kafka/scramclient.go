@@ -15,9 +15,20 @@ type XDGSCRAMClient struct {
 	*scram.Client
 	*scram.ClientConversation
 	scram.HashGeneratorFcn
+	// PasswordFunc, when set, is called on each authentication instead of
+	// using the password from the sarama config, so rotated secrets apply
+	// to new connections.
+	PasswordFunc func() (string, error)
 }
 
 func (x *XDGSCRAMClient) Begin(userName, password, authzID string) (err error) {
+	if x.PasswordFunc != nil {
+		password, err = x.PasswordFunc()
+		if err != nil {
+			return err
+		}
+	}
+
 	x.Client, err = x.HashGeneratorFcn.NewClient(userName, password, authzID)
 	if err != nil {
 		return err
@@ -0,0 +1,203 @@
+// Package keyring loads per-tenant AES keys from a local JSON file:
+//
+//	{
+//	  "tenants": {
+//	    "delivery": {
+//	      "primary": "2020-07",
+//	      "keys": {
+//	        "2020-06": "<base64 encoded 16, 24 or 32 bytes>",
+//	        "2020-07": "<base64 encoded 16, 24 or 32 bytes>"
+//	      }
+//	    }
+//	  }
+//	}
+//
+// The primary key encrypts new data; every listed key remains available for
+// decryption. Keys are rotated by adding a key, switching primary, and
+// removing the old key once no data encrypted with it remains. The file is
+// reloaded when it changes.
+package keyring
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+// ErrUnknownTenant is raised when the keyring has no keys for the tenant.
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// ErrUnknownKey is raised when the keyring has no key with the given id.
+var ErrUnknownKey = errors.New("unknown key")
+
+// ErrInvalidKey is raised when a key is not a valid AES key.
+var ErrInvalidKey = errors.New("invalid key")
+
+// reloadInterval limits how often the file is checked for changes.
+const reloadInterval = time.Second
+
+type file struct {
+	Tenants map[string]struct {
+		Primary string            `json:"primary"`
+		Keys    map[string]string `json:"keys"`
+	} `json:"tenants"`
+}
+
+type tenantKeys struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// Keyring holds the keys of every tenant.
+type Keyring struct {
+	path string
+
+	mu      sync.RWMutex
+	tenants map[string]tenantKeys
+	modTime time.Time
+	checked time.Time
+}
+
+// Open loads the keyring at path.
+func Open(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = k.load(fi.ModTime()); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Primary returns the id and the value of the key encrypting new data for tenant.
+func (k *Keyring) Primary(tenant string) (string, []byte, error) {
+	k.reload()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	t, ok := k.tenants[tenant]
+	if !ok {
+		return "", nil, errors.Wrap(ErrUnknownTenant, tenant)
+	}
+
+	return t.primary, t.keys[t.primary], nil
+}
+
+// Key returns the key of tenant with the given id.
+func (k *Keyring) Key(tenant, id string) ([]byte, error) {
+	k.reload()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	t, ok := k.tenants[tenant]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownTenant, tenant)
+	}
+
+	key, ok := t.keys[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "%s: %s", tenant, id)
+	}
+
+	return key, nil
+}
+
+// reload loads the file again when it changed. On failure the previous keys
+// stay in use.
+func (k *Keyring) reload() {
+	k.mu.RLock()
+	checked := k.checked
+	modTime := k.modTime
+	k.mu.RUnlock()
+
+	if time.Since(checked) < reloadInterval {
+		return
+	}
+
+	fi, err := os.Stat(k.path)
+
+	k.mu.Lock()
+	k.checked = time.Now()
+	k.mu.Unlock()
+
+	if err != nil {
+		logging.For("keyring").Error().Err(err).Msg("unable to check keyring")
+		return
+	}
+
+	if fi.ModTime().Equal(modTime) {
+		return
+	}
+
+	if err = k.load(fi.ModTime()); err != nil {
+		logging.For("keyring").Error().Err(err).Msg("unable to reload keyring")
+		return
+	}
+
+	logging.For("keyring").Info().Msg("keyring reloaded")
+}
+
+// load parses the file and replaces the keys.
+func (k *Keyring) load(modTime time.Time) error {
+	b, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var f file
+	if err = json.Unmarshal(b, &f); err != nil {
+		return errors.Wrap(err, "keyring")
+	}
+
+	tenants := make(map[string]tenantKeys, len(f.Tenants))
+
+	for name, t := range f.Tenants {
+		keys := make(map[string][]byte, len(t.Keys))
+
+		for id, v := range t.Keys {
+			key, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return errors.Wrapf(ErrInvalidKey, "%s: %s: %v", name, id, err)
+			}
+
+			switch len(key) {
+			case 16, 24, 32:
+			default:
+				return errors.Wrapf(ErrInvalidKey, "%s: %s: length %d", name, id, len(key))
+			}
+
+			keys[id] = key
+		}
+
+		if _, ok := keys[t.Primary]; !ok {
+			return errors.Wrapf(ErrUnknownKey, "%s: primary %s", name, t.Primary)
+		}
+
+		tenants[name] = tenantKeys{
+			primary: t.Primary,
+			keys:    keys,
+		}
+	}
+
+	k.mu.Lock()
+	k.tenants = tenants
+	k.modTime = modTime
+	k.checked = time.Now()
+	k.mu.Unlock()
+
+	return nil
+}
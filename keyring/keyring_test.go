@@ -0,0 +1,62 @@
+package keyring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyring(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "keyring")
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "keyring.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	path := writeKeyring(t, `{"tenants":{"delivery":{"primary":"k2","keys":{
+		"k1":"MDEyMzQ1Njc4OWFiY2RlZg==",
+		"k2":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	k, err := Open(path)
+	assert.NoError(t, err)
+
+	id, key, err := k.Primary("delivery")
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", id)
+	assert.Len(t, key, 32)
+
+	key, err = k.Key("delivery", "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef"), key)
+
+	_, err = k.Key("delivery", "k3")
+	assert.Equal(t, ErrUnknownKey, errors.Cause(err))
+
+	_, _, err = k.Primary("other")
+	assert.Equal(t, ErrUnknownTenant, errors.Cause(err))
+}
+
+func TestOpen_Should_Return_Err_When_Key_Is_Invalid(t *testing.T) {
+	path := writeKeyring(t, `{"tenants":{"delivery":{"primary":"k1","keys":{"k1":"c2hvcnQ="}}}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := Open(path)
+	assert.Equal(t, ErrInvalidKey, errors.Cause(err))
+}
+
+func TestOpen_Should_Return_Err_When_Primary_Is_Missing(t *testing.T) {
+	path := writeKeyring(t, `{"tenants":{"delivery":{"primary":"k2","keys":{"k1":"MDEyMzQ1Njc4OWFiY2RlZg=="}}}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := Open(path)
+	assert.Equal(t, ErrUnknownKey, errors.Cause(err))
+}
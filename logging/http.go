@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the logging configuration: GET returns it, PUT or POST
+// applies the Change sent, e.g. {"level": "debug", "packages": {"httpget": "info"}}.
+// Changes are not persisted and last until the next restart.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var ch Change
+		if err := json.NewDecoder(r.Body).Decode(&ch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		old := Current()
+
+		cfg, err := Update(ch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		For("logging").Info().Interface("from", old).Interface("to", cfg).Msg("logging configuration changed")
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(Current())
+}
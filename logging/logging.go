@@ -0,0 +1,327 @@
+// Package logging configures the loggers of the service: level, per-package
+// level overrides, output format and sampling of the per-message logs. The
+// configuration can be changed at runtime; loggers returned by For and
+// Sampled follow the changes.
+package logging
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Formats
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// ErrInvalidLevel is raised when a level name is unknown.
+var ErrInvalidLevel = errors.New("invalid log level")
+
+// ErrInvalidFormat is raised when a format is unknown.
+var ErrInvalidFormat = errors.New("invalid log format")
+
+// Config configures the loggers.
+type Config struct {
+	// Level of the packages without override: debug, info, warn or error.
+	Level string `json:"level"`
+	// Format is FormatJSON or FormatConsole.
+	Format string `json:"format"`
+	// Packages overrides the level by package name.
+	Packages map[string]string `json:"packages"`
+	// SampleEvery logs 1 of every SampleEvery per-message info logs, 0 or 1 logs them all.
+	SampleEvery uint32 `json:"sample_every"`
+}
+
+// settings is the parsed Config.
+type settings struct {
+	config   Config
+	level    zerolog.Level
+	packages map[string]zerolog.Level
+}
+
+var (
+	current atomic.Value // *settings
+	output  = &switchWriter{}
+	base    zerolog.Logger
+	mu      sync.Mutex // serializes Setup
+	loggers sync.Map   // logger name -> *zerolog.Logger
+)
+
+func init() {
+	current.Store(&settings{
+		config:   Config{Level: zerolog.DebugLevel.String(), Format: FormatJSON},
+		level:    zerolog.DebugLevel,
+		packages: map[string]zerolog.Level{},
+	})
+
+	output.set(os.Stderr, FormatJSON)
+
+	base = zerolog.New(output).With().Timestamp().Logger()
+}
+
+// ParseLevel returns the level named s. The numeric zerolog levels (0 for
+// debug, 1 for info...) are accepted as well.
+func ParseLevel(s string) (zerolog.Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < int(zerolog.DebugLevel) || n > int(zerolog.PanicLevel) {
+			return zerolog.NoLevel, errors.Wrap(ErrInvalidLevel, s)
+		}
+
+		return zerolog.Level(n), nil
+	}
+
+	switch s {
+	case "debug", "info", "warn", "error", "fatal", "panic":
+		return zerolog.ParseLevel(s)
+	case "warning":
+		return zerolog.WarnLevel, nil
+	default:
+		return zerolog.NoLevel, errors.Wrap(ErrInvalidLevel, s)
+	}
+}
+
+// Validate checks the levels and the format of cfg.
+func Validate(cfg Config) error {
+	_, err := parse(cfg)
+	return err
+}
+
+func parse(cfg Config) (*settings, error) {
+	if cfg.Format == "" {
+		cfg.Format = FormatJSON
+	}
+
+	if cfg.Format != FormatJSON && cfg.Format != FormatConsole {
+		return nil, errors.Wrap(ErrInvalidFormat, cfg.Format)
+	}
+
+	if cfg.Level == "" {
+		cfg.Level = zerolog.DebugLevel.String()
+	}
+
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Level = level.String()
+
+	s := &settings{
+		level:    level,
+		packages: make(map[string]zerolog.Level, len(cfg.Packages)),
+	}
+
+	packages := make(map[string]string, len(cfg.Packages))
+	for name, l := range cfg.Packages {
+		pl, err := ParseLevel(l)
+		if err != nil {
+			return nil, errors.Wrapf(err, "package %s", name)
+		}
+
+		name = strings.ToLower(name)
+		s.packages[name] = pl
+		packages[name] = pl.String()
+	}
+
+	cfg.Packages = packages
+	s.config = cfg
+
+	return s, nil
+}
+
+// Setup applies cfg to the loggers, and makes the global logger of zerolog
+// follow the level of the packages without override.
+func Setup(cfg Config) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, err := parse(cfg)
+	if err != nil {
+		return err
+	}
+
+	apply(s)
+
+	log.Logger = *For("")
+
+	return nil
+}
+
+// Change lists the fields of Config to change, the others are kept.
+type Change struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+	// Packages replaces the overrides when not nil, an empty map removes them.
+	Packages    map[string]string `json:"packages"`
+	SampleEvery *uint32           `json:"sample_every"`
+}
+
+// Update applies ch to the configuration in use, and returns the resulting
+// configuration. Unlike Setup it can be called while logging.
+func Update(ch Change) (Config, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	old := Current()
+	cfg := old
+
+	if ch.Level != "" {
+		cfg.Level = ch.Level
+	}
+
+	if ch.Format != "" {
+		cfg.Format = ch.Format
+	}
+
+	if ch.Packages != nil {
+		cfg.Packages = ch.Packages
+	}
+
+	if ch.SampleEvery != nil {
+		cfg.SampleEvery = *ch.SampleEvery
+	}
+
+	s, err := parse(cfg)
+	if err != nil {
+		return old, err
+	}
+
+	apply(s)
+
+	return s.config, nil
+}
+
+func apply(s *settings) {
+	output.set(output.out(), s.config.Format)
+	current.Store(s)
+
+	// the global level is the lowest one, loggers filter their own level
+	min := s.level
+	for _, l := range s.packages {
+		if l < min {
+			min = l
+		}
+	}
+
+	zerolog.SetGlobalLevel(min)
+}
+
+// Current returns the configuration in use.
+func Current() Config {
+	s := current.Load().(*settings)
+
+	cfg := s.config
+	cfg.Packages = make(map[string]string, len(s.config.Packages))
+	for k, v := range s.config.Packages {
+		cfg.Packages[k] = v
+	}
+
+	return cfg
+}
+
+// SetOutput sets the writer the logs are written to, os.Stderr by default.
+func SetOutput(w io.Writer) {
+	output.set(w, Current().Format)
+}
+
+// For returns the logger of the package pkg.
+func For(pkg string) *zerolog.Logger {
+	return logger(pkg, false)
+}
+
+// Sampled returns the logger of the package pkg for high-volume logs: info
+// and lower levels are sampled as configured by Config.SampleEvery.
+func Sampled(pkg string) *zerolog.Logger {
+	return logger(pkg, true)
+}
+
+func logger(pkg string, sampled bool) *zerolog.Logger {
+	pkg = strings.ToLower(pkg)
+
+	name := pkg
+	if sampled {
+		name += "\x00sampled"
+	}
+
+	if l, ok := loggers.Load(name); ok {
+		return l.(*zerolog.Logger)
+	}
+
+	l := base.Sample(&filter{pkg: pkg, sampled: sampled})
+	if pkg != "" {
+		l = l.With().Str("package", pkg).Logger()
+	}
+
+	actual, _ := loggers.LoadOrStore(name, &l)
+
+	return actual.(*zerolog.Logger)
+}
+
+// filter drops the events below the level of its package, and samples the
+// others when sampled.
+type filter struct {
+	pkg     string
+	sampled bool
+	counter uint32
+}
+
+// Sample reports whether an event of level lvl is logged.
+func (f *filter) Sample(lvl zerolog.Level) bool {
+	s := current.Load().(*settings)
+
+	level, ok := s.packages[f.pkg]
+	if !ok {
+		level = s.level
+	}
+
+	if lvl < level {
+		return false
+	}
+
+	every := s.config.SampleEvery
+	if !f.sampled || every <= 1 || lvl > zerolog.InfoLevel {
+		return true
+	}
+
+	return atomic.AddUint32(&f.counter, 1)%every == 1
+}
+
+// switchWriter writes to the output in the current format.
+type switchWriter struct {
+	w atomic.Value // *writer
+}
+
+type writer struct {
+	out io.Writer
+	fmt io.Writer
+}
+
+func (sw *switchWriter) set(out io.Writer, format string) {
+	w := &writer{out: out, fmt: out}
+	if format == FormatConsole {
+		w.fmt = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	}
+
+	sw.w.Store(w)
+}
+
+func (sw *switchWriter) out() io.Writer {
+	return sw.w.Load().(*writer).out
+}
+
+// Write writes p in the current format.
+func (sw *switchWriter) Write(p []byte) (int, error) {
+	return sw.w.Load().(*writer).fmt.Write(p)
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLevel(t *testing.T) {
+	for s, want := range map[string]zerolog.Level{
+		"debug":   zerolog.DebugLevel,
+		"INFO":    zerolog.InfoLevel,
+		"warning": zerolog.WarnLevel,
+		"error":   zerolog.ErrorLevel,
+		"1":       zerolog.InfoLevel,
+	} {
+		got, err := ParseLevel(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+
+	for _, s := range []string{"", "verbose", "9", "-1"} {
+		_, err := ParseLevel(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	assert.NoError(t, Validate(Config{Level: "info", Format: FormatConsole}))
+	assert.Error(t, Validate(Config{Format: "xml"}))
+	assert.Error(t, Validate(Config{Packages: map[string]string{"httpget": "loud"}}))
+}
+
+func setup(t *testing.T, cfg Config) *bytes.Buffer {
+	var buf bytes.Buffer
+
+	assert.NoError(t, Setup(cfg))
+	SetOutput(&buf)
+
+	t.Cleanup(func() {
+		SetOutput(os.Stderr)
+		_ = Setup(Config{})
+	})
+
+	return &buf
+}
+
+func Test_Package_Level_Overrides(t *testing.T) {
+	buf := setup(t, Config{Level: "warn", Packages: map[string]string{"httpget": "debug"}})
+
+	For("httpget").Debug().Msg("httpget debug")
+	For("producer").Info().Msg("producer info")
+	For("producer").Warn().Msg("producer warn")
+
+	out := buf.String()
+	assert.Contains(t, out, "httpget debug")
+	assert.Contains(t, out, `"package":"httpget"`)
+	assert.NotContains(t, out, "producer info")
+	assert.Contains(t, out, "producer warn")
+}
+
+func Test_Sampling(t *testing.T) {
+	buf := setup(t, Config{Level: "info", SampleEvery: 10})
+
+	for i := 0; i < 100; i++ {
+		Sampled("producer").Info().Msg("message")
+		For("httpget").Info().Msg("unsampled")
+	}
+
+	Sampled("producer").Error().Msg("failure")
+
+	out := buf.String()
+	assert.Equal(t, 10, strings.Count(out, `"message":"message"`))
+	assert.Equal(t, 100, strings.Count(out, "unsampled"))
+	assert.Contains(t, out, "failure")
+}
+
+func Test_Console_Format(t *testing.T) {
+	buf := setup(t, Config{Level: "info", Format: FormatConsole})
+
+	For("keyring").Info().Msg("keyring reloaded")
+
+	assert.NotContains(t, buf.String(), "{")
+	assert.Contains(t, buf.String(), "keyring reloaded")
+}
+
+func Test_Handler_Changes_Level_At_Runtime(t *testing.T) {
+	buf := setup(t, Config{Level: "info", Packages: map[string]string{"audit": "error"}})
+
+	l := For("runner")
+	l.Debug().Msg("before")
+
+	rec := httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodPut, "/log", strings.NewReader(`{"level": "debug"}`)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"debug","format":"json","packages":{"audit":"error"},"sample_every":0}`, rec.Body.String())
+
+	l.Debug().Msg("after")
+
+	assert.NotContains(t, buf.String(), "before")
+	assert.Contains(t, buf.String(), "after")
+
+	rec = httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodPut, "/log", strings.NewReader(`{"level": "loud"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "debug", Current().Level)
+}
@@ -2,140 +2,354 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net"
 	"net/http"
-	"net/http/pprof"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Shopify/sarama"
-	"github.com/rs/zerolog"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"github.com/tkanos/konsumerou"
+	"github.com/spf13/pflag"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/vladimir-klymniuk/notification-service-original/admin"
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
 	"github.com/vladimir-klymniuk/notification-service-original/config"
-	"github.com/vladimir-klymniuk/notification-service-original/httpget"
+	"github.com/vladimir-klymniuk/notification-service-original/health"
+	"github.com/vladimir-klymniuk/notification-service-original/inflight"
 	"github.com/vladimir-klymniuk/notification-service-original/kafka"
+	"github.com/vladimir-klymniuk/notification-service-original/keyring"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
 	"github.com/vladimir-klymniuk/notification-service-original/message"
 	"github.com/vladimir-klymniuk/notification-service-original/metrics"
 	"github.com/vladimir-klymniuk/notification-service-original/notify"
 	"github.com/vladimir-klymniuk/notification-service-original/producer"
-	"github.com/vladimir-klymniuk/notification-service-original/runner"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+	"github.com/vladimir-klymniuk/notification-service-original/requestlog"
+	"github.com/vladimir-klymniuk/notification-service-original/supervisor"
+	"github.com/vladimir-klymniuk/notification-service-original/tracing"
 )
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
+	os.Exit(run(os.Args[1:]))
+}
+
+// command is a subcommand of the CLI. They all read the configuration the
+// same way: file, environment and the -c and -p flags.
+type command struct {
+	name    string
+	summary string
+	// flags registers the flags of the command on pflag.CommandLine
+	flags func()
+	// run runs the command with the arguments left after the flags, and
+	// returns the exit code
+	run func(args []string) int
+}
+
+var commands = []command{
+	{name: "serve", summary: "run the service (default)", run: serve},
+	{name: "version", summary: "print the version", run: printVersion},
+	{name: "validate-config", summary: "check the configuration and print its problems", run: validateConfig},
+	{name: "send", summary: "publish notifications: send -s SERVICE [-t TENANT] [--var NAME=VALUE]... URL|PATH...", flags: sendFlags, run: send},
+	{name: "tail-errors", summary: "print the failed notifications of a service: tail-errors -s SERVICE [-t TENANT] [--since 1h]", flags: tailFlags, run: tailErrors},
+	{name: "replay", summary: "publish again notifications of a service: replay -s SERVICE [-t TENANT] --since 1h [--id ID]... [--dry-run]", flags: replayFlags, run: replay},
+}
+
+// run runs the command named by the arguments, serve when there is none.
+func run(args []string) int {
+	cmd := commands[0]
+
+	printConfig := pflag.Bool("print-config", false, "print the effective configuration, with the source of each value, and exit")
+
+	if len(args) > 0 && args[0] == "help" {
+		config.ParseFlags()
+		usage()
+		return 0
+	}
+
+	if name, ok := commandName(args); ok {
+		if cmd, ok = findCommand(name); !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+			usage()
+			return 2
+		}
+	}
+
+	if cmd.flags != nil {
+		cmd.flags()
+	}
+
+	pflag.Usage = usage
+
+	rest := config.ParseFlags()
+	if len(rest) > 0 && rest[0] == cmd.name {
+		rest = rest[1:]
+	}
+
+	if *printConfig {
+		return printEffectiveConfig()
+	}
+
+	return cmd.run(rest)
+}
+
+// commandName returns the command of args: the first argument, or when args
+// start with flags, the first argument naming a command, so that the command
+// can follow the flags of the configuration, e.g. -c FILE send.
+func commandName(args []string) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+
+	if !strings.HasPrefix(args[0], "-") {
+		return args[0], true
+	}
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if _, ok := findCommand(arg); ok {
+			return arg, true
+		}
+	}
+
+	return "", false
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+
+	return command{}, false
+}
+
+// usage prints the commands and the flags.
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [flags]\n\ncommands:\n", appName)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.summary)
+	}
+
+	if flags := pflag.CommandLine.FlagUsages(); flags != "" {
+		fmt.Fprintf(os.Stderr, "\nflags:\n%s", flags)
+	}
+}
+
+// serve runs the service until its http server stops.
+func serve(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %q, see %s help\n", args, appName)
+		return 2
+	}
+
 	cfg := config.GetConfig()
-	loadOSArgs(cfg)
 
 	// zerolog.TimeFieldFormat = zerolog.TimeFieldFormat
 
-	zerolog.SetGlobalLevel(zerolog.Level(cfg.Log.Level))
+	if err := logging.Setup(cfg.Log.Logging()); err != nil {
+		log.Fatal().Err(err).Msg("unable to set up logging")
+	}
 
 	log.Info().Msg(fmt.Sprintf("starting %s port %d", appName, cfg.App.Port))
 
 	httpAddr := ":" + strconv.Itoa(cfg.App.Port)
 	mux := http.NewServeMux()
 
-	if cfg.App.EnablePprof {
-		mux.HandleFunc("/debug/pprof/", pprof.Index)
-		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	}
+	lb := admin.NewLoadBalancer()
 
-	ctx := context.Background()
+	adminServer := admin.NewServer(cfg.Admin.Token.Value)
+	adminServer.HandleFunc("/removelb", lb.RemoveHandler)
+	adminServer.HandleFunc("/addlb", lb.AddHandler)
+	adminServer.HandleFunc("/log", logging.Handler)
+
+	// configuration applied, the services are replaced by reloads
+	var current atomic.Value
+	current.Store(cfg)
+	adminServer.HandleFunc("/config", config.Handler(func() *config.Configuration {
+		return current.Load().(*config.Configuration)
+	}))
 
-	sconfig := sarama.NewConfig()
-	sconfig.Version = sarama.V2_4_0_0
-	sconfig.Consumer.Offsets.CommitInterval = time.Second
+	tasks := inflight.NewRegistry()
+	adminServer.HandleFunc("/tasks", tasks.Handler)
 
-	if cfg.Kafka.UseCredentials {
-		sconfig.Net.SASL.Enable = cfg.Kafka.UseCredentials
-		sconfig.Net.SASL.User = cfg.Kafka.Username
-		sconfig.Net.SASL.Password = cfg.Kafka.Password
-		sconfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		sconfig.Net.SASL.Handshake = true
-		sconfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &kafka.XDGSCRAMClient{HashGeneratorFcn: kafka.SHA512} }
-		sconfig.Producer.RequiredAcks = sarama.WaitForLocal
-		sconfig.Producer.Compression = sarama.CompressionSnappy
-		// sconfig.Producer.Flush.Frequency = 50 * time.Millisecond
+	if cfg.App.EnablePprof {
+		adminServer.EnablePprof()
 	}
 
-	service := cfg.Services[0]
+	ctx := context.Background()
 
-	log.Info().Msgf("service: %v", service)
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		Path:        cfg.Tracing.Path,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: appName,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to set up tracing")
+	}
+	defer shutdownTracing(ctx)
 
-	dspErr, err := producer.NewPublisher(service.Topic, service.Error, cfg.Kafka.Brokers, sconfig)
+	sconfig, err := newSaramaConfig(cfg)
 	if err != nil {
-		log.Fatal().Msg(fmt.Sprintf("error creating kafka producer: %v", err))
+		log.Fatal().Err(err).Msg("unable to configure kafka")
 	}
 
-	// metrics
-	dspErr = metrics.NewPublisher(dspErr, service.Error, service.Name)
+	redactor := redact.New(cfg.Redact.QueryParams, cfg.Redact.Headers)
 
-	// message decoder
-	decoder := message.NewDecoder()
+	auditor, closeAuditor, err := newAuditor(cfg, sconfig, redactor)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to create audit sink")
+	}
+	// closed last, once the services recorded the outcomes of their deliveries
+	defer func() {
+		if err := closeAuditor(); err != nil {
+			log.Error().Err(err).Msg("unable to close audit sink")
+		}
+	}()
 
-	rb := runner.NewBuilder(service.Retry, service.RetryDelay)
-	mrb := metrics.NewRunnerBuilder(rb, service.Name)
-	// TODO: here create 3 listeners
-	handler := httpget.MakeWorkerEndpoint(httpget.NewWorker(
-		getHttpClient(service.Timeout),
-		dspErr,
-		decoder,
-		service.MaxRequests,
-		mrb,
-	))
+	// keyring
+	kr, err := openKeyring(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to open keyring")
+	}
 
-	listener, err := konsumerou.NewListener(ctx, // ultimately we should start one listener per service
-		cfg.Kafka.Brokers, // kafka brokers
-		service.GroupID,   // group id
-		service.Topic,     // the topic name
-		metrics.NewMetricssWorker(service.Name, handler), // the handler
-		sconfig)
+	// readiness
+	checker := health.NewChecker(cfg.App.ReadinessTimeout)
 
+	kafkaClient, err := sarama.NewClient(cfg.Kafka.Brokers, sconfig)
 	if err != nil {
-		log.Fatal().Msg(fmt.Sprintf("listener not starting, %v", err))
+		log.Fatal().Err(err).Msg("unable to create kafka client")
 	}
-	// Subscribe your service to the topic
-	listener.Subscribe()
-	defer listener.Close()
+	defer kafkaClient.Close()
 
-	bsp, err := producer.NewPublisher("", service.Topic, cfg.Kafka.Brokers, sconfig)
+	kafkaAdmin, err := sarama.NewClusterAdminFromClient(kafkaClient)
 	if err != nil {
-		log.Error().Err(err).Msg("error creating kafka producer")
+		log.Fatal().Err(err).Msg("unable to create kafka admin")
+	}
+
+	checker.Add("kafka_brokers", "", true, kafka.BrokerCheck(kafkaClient))
+
+	// one pipeline per service, replaced when the services configuration changes
+	router := notify.NewRouter()
+
+	factory := &pipelineFactory{
+		cfg:        cfg,
+		sconfig:    sconfig,
+		redactor:   redactor,
+		auditor:    auditor,
+		keyring:    kr,
+		decoder:    newDecoder(kr),
+		checker:    checker,
+		kafkaAdmin: kafkaAdmin,
+		tasks:      tasks,
+		router:     router,
+	}
+
+	services := supervisor.New(factory.start, supervisor.WithDrainTimeout(cfg.App.DrainTimeout))
+	if _, err = services.Apply(ctx, cfg.Services); err != nil {
+		log.Fatal().Err(err).Msg("unable to start services")
 	}
+	defer services.Stop(ctx)
+
+	reloads := metrics.NewReloadObserver()
+	config.Watch(func(c *config.Configuration, err error) {
+		if err != nil {
+			logging.For("config").Error().Err(err).Msg("configuration not reloaded")
+			reloads.Failed()
+			return
+		}
 
-	// message encoder
-	enc := message.NewEncoder()
+		changes, err := services.Apply(ctx, c.Services)
+		if err != nil {
+			logging.For("config").Error().Err(err).Msg("configuration partially reloaded")
+			reloads.Failed()
+			return
+		}
 
-	// metrics
-	bsp = metrics.NewPublisher(bsp, service.Topic, service.Name)
+		if !changes.Empty() {
+			logging.For("config").Info().
+				Strs("added", changes.Added).
+				Strs("removed", changes.Removed).
+				Strs("changed", changes.Changed).
+				Msg("configuration reloaded")
+		}
 
-	bs := notify.NewService(bsp, enc)
+		current.Store(current.Load().(*config.Configuration).Reloaded(c))
+		reloads.Reloaded(len(changes.Added), len(changes.Removed), len(changes.Changed))
+	})
 
-	notifyEndpoint := notify.NewEndpoints(bs)
-	notifyHandler := notify.NewHTTPHandler(notifyEndpoint).ServeHTTP
-	mux.HandleFunc("/notify", metrics.NewHTTPMiddleware("notify", notifyHandler))
+	notifyEndpoint := notify.NewEndpoints(router)
+	notifyHandler := notify.NewHTTPHandler(notifyEndpoint, auditor).ServeHTTP
+	mux.HandleFunc("/notify", metrics.NewHTTPMiddleware("notify", requestlog.NewHTTPMiddleware("notify",
+		tracing.NewHTTPMiddleware("notify", notifyHandler), requestlog.WithAccessLog(cfg.Log.Verbose))))
 
-	mux.HandleFunc("/healthz", healthzHandler)
-	mux.HandleFunc("/removelb", removeLBHandler)
+	mux.HandleFunc("/healthz", lb.HealthzHandler)
+	mux.HandleFunc("/readyz", checker.ReadyzHandler)
 	mux.Handle("/metrics", promhttp.Handler())
 
+	if cfg.Admin.Port != 0 {
+		adminAddr := net.JoinHostPort(cfg.Admin.Host, strconv.Itoa(cfg.Admin.Port))
+
+		if !cfg.Admin.Token.IsSet() {
+			log.Warn().Msg("no admin token configured, all admin requests will be refused")
+		}
+
+		go func() {
+			log.Info().Msgf("starting admin server on %s", adminAddr)
+			log.Error().Err(http.ListenAndServe(adminAddr, adminServer)).Msg("admin server stopped")
+		}()
+	}
+
 	httpServer := &http.Server{
 		Addr:    httpAddr,
 		Handler: mux,
 	}
 
-	log.Info().Err(httpServer.ListenAndServe()).Msg(fmt.Sprintf("exit %s", appName))
+	// on SIGINT or SIGTERM, stop accepting notifications, then the deferred
+	// calls drain the services and flush the audit sink
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+
+		log.Info().Msg(fmt.Sprintf("stopping %s", appName))
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, cfg.App.DrainTimeout)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("unable to stop the http server")
+		}
+	}()
+
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Error().Err(err).Msg(fmt.Sprintf("exit %s", appName))
+		return 1
+	}
+
+	log.Info().Msg(fmt.Sprintf("exit %s", appName))
+
+	return 0
 }
 
 var (
@@ -145,45 +359,132 @@ var (
 	buildtime  = ""
 )
 
-func loadOSArgs(_ *config.Configuration) {
-	if len(os.Args) == 2 {
-		if os.Args[1] == "version" {
-			fmt.Printf("%s %s\n", appName, version)
-			fmt.Printf("git commit : %s\n", gitversion)
-			fmt.Printf("build time : %s\n", buildtime)
-			os.Exit(0)
+func printVersion([]string) int {
+	fmt.Printf("%s %s\n", appName, version)
+	fmt.Printf("git commit : %s\n", gitversion)
+	fmt.Printf("build time : %s\n", buildtime)
+
+	return 0
+}
+
+// printEffectiveConfig prints the settings of the configuration, one per
+// line with their source, and returns the exit code.
+func printEffectiveConfig() int {
+	cfg, err := config.Check()
+	if err != nil {
+		return fail("print-config", err)
+	}
+
+	for _, s := range cfg.Settings() {
+		source := s.Source
+		if s.File != "" {
+			source += " " + s.File
+		}
+
+		v, _ := json.Marshal(s.Value)
+		fmt.Printf("%s = %s (%s)\n", s.Key, v, source)
+	}
+
+	return 0
+}
+
+// validateConfig prints the problems of the configuration, and returns the
+// exit code: 0 when it is valid.
+func validateConfig([]string) int {
+	_, err := config.Check()
+	if err == nil {
+		fmt.Println("configuration is valid")
+		return 0
+	}
+
+	if v, ok := errors.Cause(err).(*config.ValidationError); ok {
+		fmt.Printf("configuration is invalid, %d problems:\n", len(v.Problems))
+		for _, p := range v.Problems {
+			fmt.Printf("  - %v\n", p)
 		}
+
+		return 1
 	}
+
+	fmt.Printf("configuration is invalid: %v\n", err)
+
+	return 1
 }
 
-var status = http.StatusOK
+// newSaramaConfig returns the configuration of the kafka clients.
+func newSaramaConfig(cfg *config.Configuration) (*sarama.Config, error) {
+	kafkaConfig := cfg.Kafka.Client()
+	if kafkaConfig.ClientID == "" {
+		kafkaConfig.ClientID = clientID()
+	}
 
-// HealthzHandler returns HTTP Status 200 when the application is running with no issues
-func healthzHandler(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(status)
+	return kafka.NewConfig(kafkaConfig)
 }
 
-// RemoveLBHandler forces the HealthzHandler to return 403 on all subsequent requests so
-// the loadbalancer to removes this server from its available pool.
-func removeLBHandler(w http.ResponseWriter, _ *http.Request) {
-	status = http.StatusForbidden
-	w.WriteHeader(http.StatusOK)
+// openKeyring opens the keyring, loaded whenever one is configured so that
+// encrypted messages can still be read after encryption is disabled. It is
+// nil when none is configured.
+func openKeyring(cfg *config.Configuration) (*keyring.Keyring, error) {
+	if cfg.Encryption.Keyring == "" {
+		return nil, nil
+	}
+
+	return keyring.Open(cfg.Encryption.Keyring)
 }
 
-func getHttpClient(timeout time.Duration) *http.Client {
-	netTransport := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout:   time.Second,
-			KeepAlive: 0,
-		}).Dial,
-		TLSHandshakeTimeout: 5 * time.Second,
-		IdleConnTimeout:     0,
-		MaxIdleConnsPerHost: 50000,
-		MaxIdleConns:        50000,
+// newDecoder returns the decoder of the messages of the service topics.
+func newDecoder(kr *keyring.Keyring) *message.Decoder {
+	if kr == nil {
+		return message.NewDecoder()
 	}
 
-	return &http.Client{
-		Timeout:   timeout,
-		Transport: netTransport,
+	return message.NewDecoder(message.WithKeyring(kr))
+}
+
+// newEncoder returns the encoder of the messages of the topic of service.
+func newEncoder(cfg *config.Configuration, kr *keyring.Keyring, service config.ServiceConfig) *message.Encoder {
+	if kr == nil || !cfg.Encryption.Enabled {
+		return message.NewEncoder()
+	}
+
+	return message.NewEncoder(message.WithEncryption(kr, service.TenantID))
+}
+
+// clientID identifies this instance to the kafka brokers, so the partitions
+// assigned to it can be told apart from the ones of the other instances.
+func clientID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return appName
+	}
+
+	return appName + "-" + invalidClientIDChars.ReplaceAllString(hostname, "_")
+}
+
+var invalidClientIDChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// newAuditor creates the auditor writing to the configured sink, and the
+// function flushing and closing the sink.
+func newAuditor(cfg *config.Configuration, sconfig *sarama.Config, redactor *redact.Redactor) (audit.Auditor, func() error, error) {
+	switch cfg.Audit.Sink {
+	case config.AuditSinkFile:
+		sink, err := audit.NewFileSink(cfg.Audit.Path, int64(cfg.Audit.MaxSizeMB)<<20, cfg.Audit.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return audit.New(sink), sink.Close, nil
+	case config.AuditSinkKafka:
+		// the audit records are not logged in the operational log
+		p, err := producer.NewPublisher("", cfg.Audit.Topic, cfg.Kafka.Brokers, sconfig, producer.WithRedactor(redactor), producer.WithoutMessageLog())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sink := audit.NewKafkaSink(p, p.Close)
+
+		return audit.New(sink), sink.Close, nil
+	default:
+		return audit.Nop(), func() error { return nil }, nil
 	}
 }
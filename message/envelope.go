@@ -0,0 +1,145 @@
+package message
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// algorithmAESGCM identifies envelopes encrypted with AES-GCM.
+const algorithmAESGCM = "aes-gcm"
+
+// ErrNoKeyring is raised when an encrypted message is decoded without keyring.
+var ErrNoKeyring = errors.New("encrypted message and no keyring")
+
+// ErrUnsupportedAlgorithm is raised when an envelope uses an unknown algorithm.
+var ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+
+// envelope is the record stored in kafka for encrypted messages. The payload
+// is encrypted with a random data key, itself encrypted with the tenant key
+// identified by KeyID.
+type envelope struct {
+	Algorithm string `json:"enc"`
+	Tenant    string `json:"tenant"`
+	KeyID     string `json:"kid"`
+	DataKey   []byte `json:"dek"`
+	Data      []byte `json:"data"`
+}
+
+// parseEnvelope reports whether b is an envelope.
+func parseEnvelope(b []byte) (envelope, bool, error) {
+	var env envelope
+
+	if err := json.Unmarshal(b, &env); err != nil {
+		return env, false, err
+	}
+
+	if env.Algorithm == "" {
+		return env, false, nil
+	}
+
+	if env.Algorithm != algorithmAESGCM {
+		return env, false, errors.Wrap(ErrUnsupportedAlgorithm, env.Algorithm)
+	}
+
+	return env, true, nil
+}
+
+// seal encrypts plaintext for tenant.
+func seal(k Keyring, tenant string, plaintext []byte) ([]byte, error) {
+	kid, kek, err := k.Primary(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	dek := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+
+	aad := additionalData(tenant, kid)
+
+	wrapped, err := encrypt(kek, dek, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encrypt(dek, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope{
+		Algorithm: algorithmAESGCM,
+		Tenant:    tenant,
+		KeyID:     kid,
+		DataKey:   wrapped,
+		Data:      data,
+	})
+}
+
+// open decrypts the payload of env.
+func open(k Keyring, env envelope) ([]byte, error) {
+	kek, err := k.Key(env.Tenant, env.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	aad := additionalData(env.Tenant, env.KeyID)
+
+	dek, err := decrypt(kek, env.DataKey, aad)
+	if err != nil {
+		return nil, errors.Wrap(err, "data key")
+	}
+
+	return decrypt(dek, env.Data, aad)
+}
+
+// additionalData binds the ciphertexts to the tenant and key they belong to.
+func additionalData(tenant, kid string) []byte {
+	return []byte(tenant + "\x00" + kid)
+}
+
+// encrypt returns the nonce followed by the AES-GCM ciphertext.
+func encrypt(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// decrypt reverses encrypt.
+func decrypt(key, ciphertext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce := ciphertext[:gcm.NonceSize()]
+
+	return gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
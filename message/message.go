@@ -2,37 +2,124 @@ package message
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"time"
 )
 
 const TypeHTTPGet = "httpget"
 
 type Message struct {
+	ID          string `json:"id,omitempty"`
 	Type        string `json:"type"`
 	HTTPRequest string `json:"http_request"`
+	// Path and Variables build the URL from the destination of the service,
+	// when HTTPRequest is empty
+	Path      string            `json:"path,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	// AcceptedAt is when /notify accepted the message
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// NewID returns a random notification ID.
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Keyring provides the keys used for envelope encryption.
+type Keyring interface {
+	Primary(tenant string) (string, []byte, error)
+	Key(tenant, id string) ([]byte, error)
 }
 
 type Encoder struct {
+	keyring Keyring
+	tenant  string
 }
 
-func NewEncoder() *Encoder {
-	return &Encoder{}
+// EncoderOption modifies Encoder. Used in NewEncoder.
+type EncoderOption func(*Encoder)
+
+// WithEncryption makes the encoder encrypt messages with the primary key
+// of tenant.
+func WithEncryption(k Keyring, tenant string) EncoderOption {
+	return func(e *Encoder) {
+		e.keyring = k
+		e.tenant = tenant
+	}
+}
+
+func NewEncoder(options ...EncoderOption) *Encoder {
+	e := &Encoder{}
+
+	for _, option := range options {
+		option(e)
+	}
+
+	return e
 }
 
 func (e *Encoder) Encode(ctx context.Context, message Message) ([]byte, error) {
-	return json.Marshal(message)
+	b, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.keyring == nil {
+		return b, nil
+	}
+
+	return seal(e.keyring, e.tenant, b)
 }
 
 type Decoder struct {
+	keyring Keyring
 }
 
-func NewDecoder() *Decoder {
-	return &Decoder{}
+// DecoderOption modifies Decoder. Used in NewDecoder.
+type DecoderOption func(*Decoder)
+
+// WithKeyring makes the decoder decrypt encrypted messages. Plain messages
+// are still decoded.
+func WithKeyring(k Keyring) DecoderOption {
+	return func(d *Decoder) {
+		d.keyring = k
+	}
+}
+
+func NewDecoder(options ...DecoderOption) *Decoder {
+	d := &Decoder{}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	return d
 }
 
 func (d *Decoder) Decode(ctx context.Context, b []byte) (Message, error) {
 	m := Message{}
-	err := json.Unmarshal(b, &m)
+
+	env, ok, err := parseEnvelope(b)
+	if err != nil {
+		return m, err
+	}
+
+	if ok {
+		if d.keyring == nil {
+			return m, ErrNoKeyring
+		}
+
+		if b, err = open(d.keyring, env); err != nil {
+			return m, err
+		}
+	}
+
+	err = json.Unmarshal(b, &m)
 
 	return m, err
 }
@@ -0,0 +1,93 @@
+package message
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockKeyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+func (k *mockKeyring) Primary(tenant string) (string, []byte, error) {
+	return k.primary, k.keys[k.primary], nil
+}
+
+func (k *mockKeyring) Key(tenant, id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+
+	return key, nil
+}
+
+func newMockKeyring() *mockKeyring {
+	return &mockKeyring{
+		primary: "k1",
+		keys: map[string][]byte{
+			"k1": []byte("0123456789abcdef0123456789abcdef"),
+			"k2": []byte("fedcba9876543210"),
+		},
+	}
+}
+
+func Test_Encode_Decode_Plain(t *testing.T) {
+	ctx := context.Background()
+	m := Message{Type: TypeHTTPGet, HTTPRequest: "http://example.com/?id=42"}
+
+	b, err := NewEncoder().Encode(ctx, m)
+	assert.NoError(t, err)
+
+	got, err := NewDecoder(WithKeyring(newMockKeyring())).Decode(ctx, b)
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func Test_Encode_Decode_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	k := newMockKeyring()
+	m := Message{Type: TypeHTTPGet, HTTPRequest: "http://example.com/?id=42"}
+
+	b, err := NewEncoder(WithEncryption(k, "tenant")).Encode(ctx, m)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "example.com")
+	assert.Contains(t, string(b), `"kid":"k1"`)
+
+	// rotation: messages encrypted with the previous primary stay readable
+	k.primary = "k2"
+
+	got, err := NewDecoder(WithKeyring(k)).Decode(ctx, b)
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func Test_Decode_Should_Return_Err_When_No_Keyring(t *testing.T) {
+	ctx := context.Background()
+
+	b, err := NewEncoder(WithEncryption(newMockKeyring(), "tenant")).Encode(ctx, Message{})
+	assert.NoError(t, err)
+
+	_, err = NewDecoder().Decode(ctx, b)
+	assert.Equal(t, ErrNoKeyring, err)
+}
+
+func Test_Decode_Should_Return_Err_When_Tampered(t *testing.T) {
+	ctx := context.Background()
+	k := newMockKeyring()
+
+	b, err := NewEncoder(WithEncryption(k, "tenant")).Encode(ctx, Message{Type: TypeHTTPGet})
+	assert.NoError(t, err)
+
+	// a record moved to another tenant must not decrypt
+	env, _, err := parseEnvelope(b)
+	assert.NoError(t, err)
+	env.Tenant = "other"
+
+	_, err = open(k, env)
+	assert.Error(t, err)
+}
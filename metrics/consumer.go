@@ -0,0 +1,306 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+var cls *consumerLagService
+
+type consumerLagService struct {
+	highWaterMark *prometheus.GaugeVec
+	committed     *prometheus.GaugeVec
+	lag           *prometheus.GaugeVec
+	assigned      *prometheus.GaugeVec
+	errors        *prometheus.CounterVec
+	// groups reporting the series
+	live *liveSeries
+}
+
+func init() {
+	cls = consumerLagMiddleware()
+}
+
+func consumerLagMiddleware() *consumerLagService {
+	m := consumerLagService{live: newLiveSeries()}
+
+	fieldKeys := []string{"group", "topic", "partition"}
+
+	m.highWaterMark = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "consumer",
+			Subsystem: "partition",
+			Name:      "high_water_mark",
+			Help:      "Offset of the next message produced to the partition",
+		}, fieldKeys)
+	prometheus.MustRegister(m.highWaterMark)
+
+	m.committed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "consumer",
+			Subsystem: "partition",
+			Name:      "committed_offset",
+			Help:      "Offset committed by the consumer group",
+		}, fieldKeys)
+	prometheus.MustRegister(m.committed)
+
+	m.lag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "consumer",
+			Subsystem: "partition",
+			Name:      "lag",
+			Help:      "Number of messages not consumed yet by the consumer group",
+		}, fieldKeys)
+	prometheus.MustRegister(m.lag)
+
+	m.assigned = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "consumer",
+			Subsystem: "partition",
+			Name:      "assigned",
+			Help:      "1 when the partition is assigned to this instance, 0 otherwise",
+		}, fieldKeys)
+	prometheus.MustRegister(m.assigned)
+
+	m.errors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "consumer",
+			Subsystem: "monitor",
+			Name:      "error_count",
+			Help:      "Number of failed refreshes of the consumer offsets",
+		}, []string{"group"})
+	prometheus.MustRegister(m.errors)
+
+	return &m
+}
+
+// offsetClient reads partitions and their offsets.
+type offsetClient interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+}
+
+// groupAdmin reads the state of consumer groups.
+type groupAdmin interface {
+	ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error)
+	DescribeConsumerGroups(groups []string) ([]*sarama.GroupDescription, error)
+}
+
+// ConsumerMonitor periodically reports, for each partition of the topics of a
+// consumer group, the high-water mark, the committed offset, the lag, and
+// whether the partition is assigned to this instance.
+type ConsumerMonitor struct {
+	client   offsetClient
+	admin    groupAdmin
+	group    string
+	clientID string
+	topics   []string
+	// initial offset of the group on the partitions without committed offset
+	initial int64
+	close   func() error
+	// mu guards the refreshes, so that a closed monitor reports nothing
+	mu     sync.Mutex
+	closed bool
+	// labels of the partitions reported
+	reported map[string][]string
+}
+
+// NewConsumerMonitor creates ConsumerMonitor for group consuming topics.
+// The partitions assigned to this instance are the ones of the group members
+// with the client ID of config, and the group starts from its initial offset.
+func NewConsumerMonitor(brokers []string, config *sarama.Config, group string, topics []string) (*ConsumerMonitor, error) {
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	cls.live.acquire(group)
+
+	return &ConsumerMonitor{
+		client:   client,
+		admin:    admin,
+		group:    group,
+		clientID: config.ClientID,
+		topics:   topics,
+		initial:  config.Consumer.Offsets.Initial,
+		close:    admin.Close,
+	}, nil
+}
+
+// Run refreshes the metrics every interval until ctx is done.
+func (m *ConsumerMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.update()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// update refreshes the metrics, unless the monitor is closed.
+func (m *ConsumerMonitor) update() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	if err := m.refresh(); err != nil {
+		cls.errors.WithLabelValues(m.group).Inc()
+		logging.For("metrics").Warn().Err(err).Str("group", m.group).Msg("unable to refresh consumer offsets")
+	}
+}
+
+// Close closes the connections to the brokers, and deletes the series of the
+// group when no other monitor reports them.
+func (m *ConsumerMonitor) Close() error {
+	// closing the connections first ends a refresh in progress
+	err := m.close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+
+	if cls.live.release(m.group) {
+		for _, labels := range m.reported {
+			cls.highWaterMark.DeleteLabelValues(labels...)
+			cls.committed.DeleteLabelValues(labels...)
+			cls.lag.DeleteLabelValues(labels...)
+			cls.assigned.DeleteLabelValues(labels...)
+		}
+
+		cls.errors.DeleteLabelValues(m.group)
+	}
+
+	return err
+}
+
+func (m *ConsumerMonitor) refresh() error {
+	partitions := make(map[string][]int32, len(m.topics))
+
+	for _, topic := range m.topics {
+		ps, err := m.client.Partitions(topic)
+		if err != nil {
+			return err
+		}
+
+		partitions[topic] = ps
+	}
+
+	assigned, err := m.assignedPartitions()
+	if err != nil {
+		return err
+	}
+
+	offsets, err := m.admin.ListConsumerGroupOffsets(m.group, partitions)
+	if err != nil {
+		return err
+	}
+
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			labels := []string{m.group, topic, strconv.Itoa(int(p))}
+
+			if m.reported == nil {
+				m.reported = make(map[string][]string)
+			}
+
+			m.reported[topic+"/"+labels[2]] = labels
+
+			hwm, err := m.client.GetOffset(topic, p, sarama.OffsetNewest)
+			if err != nil {
+				return err
+			}
+
+			cls.highWaterMark.WithLabelValues(labels...).Set(float64(hwm))
+
+			if assigned[topic][p] {
+				cls.assigned.WithLabelValues(labels...).Set(1)
+			} else {
+				cls.assigned.WithLabelValues(labels...).Set(0)
+			}
+
+			committed := int64(-1)
+			if b := offsets.GetBlock(topic, p); b != nil && b.Err == sarama.ErrNoError {
+				committed = b.Offset
+			}
+
+			if committed < 0 {
+				cls.committed.DeleteLabelValues(labels...)
+
+				// nothing committed yet, the group starts from its initial offset
+				if committed, err = m.client.GetOffset(topic, p, m.initial); err != nil {
+					return err
+				}
+			} else {
+				cls.committed.WithLabelValues(labels...).Set(float64(committed))
+			}
+
+			lag := hwm - committed
+			if lag < 0 {
+				lag = 0
+			}
+
+			cls.lag.WithLabelValues(labels...).Set(float64(lag))
+		}
+	}
+
+	return nil
+}
+
+// assignedPartitions returns the partitions assigned to the members of the
+// group with the client ID of this instance.
+func (m *ConsumerMonitor) assignedPartitions() (map[string]map[int32]bool, error) {
+	groups, err := m.admin.DescribeConsumerGroups([]string{m.group})
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := make(map[string]map[int32]bool)
+
+	for _, g := range groups {
+		for _, member := range g.Members {
+			if member.ClientId != m.clientID {
+				continue
+			}
+
+			a, err := member.GetMemberAssignment()
+			if err != nil || a == nil {
+				continue
+			}
+
+			for topic, ps := range a.Topics {
+				if assigned[topic] == nil {
+					assigned[topic] = make(map[int32]bool)
+				}
+
+				for _, p := range ps {
+					assigned[topic][p] = true
+				}
+			}
+		}
+	}
+
+	return assigned, nil
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOffsetClient struct {
+	newest map[int32]int64
+	oldest map[int32]int64
+}
+
+func (c *fakeOffsetClient) Partitions(string) ([]int32, error) {
+	return []int32{0, 1}, nil
+}
+
+func (c *fakeOffsetClient) GetOffset(_ string, p int32, t int64) (int64, error) {
+	if t == sarama.OffsetOldest {
+		return c.oldest[p], nil
+	}
+
+	return c.newest[p], nil
+}
+
+type fakeGroupAdmin struct {
+	offsets *sarama.OffsetFetchResponse
+	groups  []*sarama.GroupDescription
+}
+
+func (a *fakeGroupAdmin) ListConsumerGroupOffsets(string, map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	return a.offsets, nil
+}
+
+func (a *fakeGroupAdmin) DescribeConsumerGroups([]string) ([]*sarama.GroupDescription, error) {
+	return a.groups, nil
+}
+
+// memberAssignment encodes the assignment of partitions of topic, as sent by the brokers.
+func memberAssignment(topic string, partitions ...int32) []byte {
+	b := &bytes.Buffer{}
+	_ = binary.Write(b, binary.BigEndian, int16(0))
+	_ = binary.Write(b, binary.BigEndian, int32(1))
+	_ = binary.Write(b, binary.BigEndian, int16(len(topic)))
+	b.WriteString(topic)
+	_ = binary.Write(b, binary.BigEndian, int32(len(partitions)))
+	for _, p := range partitions {
+		_ = binary.Write(b, binary.BigEndian, p)
+	}
+	_ = binary.Write(b, binary.BigEndian, int32(-1))
+
+	return b.Bytes()
+}
+
+func Test_ConsumerMonitor_refresh(t *testing.T) {
+	offsets := &sarama.OffsetFetchResponse{}
+	offsets.AddBlock("topic", 0, &sarama.OffsetFetchResponseBlock{Offset: 40})
+	offsets.AddBlock("topic", 1, &sarama.OffsetFetchResponseBlock{Offset: -1})
+
+	m := &ConsumerMonitor{
+		client: &fakeOffsetClient{
+			newest: map[int32]int64{0: 100, 1: 30},
+			oldest: map[int32]int64{0: 0, 1: 10},
+		},
+		admin: &fakeGroupAdmin{
+			offsets: offsets,
+			groups: []*sarama.GroupDescription{{
+				GroupId: "group",
+				Members: map[string]*sarama.GroupMemberDescription{
+					"me":    {ClientId: "me", MemberAssignment: memberAssignment("topic", 1)},
+					"other": {ClientId: "other", MemberAssignment: memberAssignment("topic", 0)},
+				},
+			}},
+		},
+		group:    "group",
+		clientID: "me",
+		topics:   []string{"topic"},
+		initial:  sarama.OffsetOldest,
+	}
+
+	// committed before, by a group since deleted
+	cls.committed.WithLabelValues("group", "topic", "1").Set(5)
+
+	assert.NoError(t, m.refresh())
+
+	assert.Equal(t, 100.0, testutil.ToFloat64(cls.highWaterMark.WithLabelValues("group", "topic", "0")))
+	assert.Equal(t, 40.0, testutil.ToFloat64(cls.committed.WithLabelValues("group", "topic", "0")))
+	assert.Equal(t, 60.0, testutil.ToFloat64(cls.lag.WithLabelValues("group", "topic", "0")))
+	assert.Equal(t, 20.0, testutil.ToFloat64(cls.lag.WithLabelValues("group", "topic", "1")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(cls.assigned.WithLabelValues("group", "topic", "0")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(cls.assigned.WithLabelValues("group", "topic", "1")))
+	assert.False(t, cls.committed.DeleteLabelValues("group", "topic", "1"))
+
+	// a new group starts from the newest offset by default
+	m.initial = sarama.OffsetNewest
+	assert.NoError(t, m.refresh())
+	assert.Equal(t, 0.0, testutil.ToFloat64(cls.lag.WithLabelValues("group", "topic", "1")))
+}
+
+func Test_ConsumerMonitor_Close_Deletes_The_Series_Of_A_Removed_Group(t *testing.T) {
+	offsets := &sarama.OffsetFetchResponse{}
+	offsets.AddBlock("removed", 0, &sarama.OffsetFetchResponseBlock{Offset: 40})
+
+	m := &ConsumerMonitor{
+		client:  &fakeOffsetClient{newest: map[int32]int64{0: 100}},
+		admin:   &fakeGroupAdmin{offsets: offsets},
+		group:   "removed",
+		topics:  []string{"removed"},
+		initial: sarama.OffsetOldest,
+		close:   func() error { return nil },
+	}
+	cls.live.acquire(m.group)
+
+	m.update()
+	assert.Equal(t, 60.0, testutil.ToFloat64(cls.lag.WithLabelValues("removed", "removed", "0")))
+
+	assert.NoError(t, m.Close())
+	assert.False(t, cls.lag.DeleteLabelValues("removed", "removed", "0"))
+	assert.False(t, cls.highWaterMark.DeleteLabelValues("removed", "removed", "0"))
+
+	// a closed monitor reports nothing
+	m.update()
+	assert.False(t, cls.lag.DeleteLabelValues("removed", "removed", "0"))
+}
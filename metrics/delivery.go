@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherHost replaces the destination hosts over the cardinality cap.
+const otherHost = "other"
+
+var ds *deliveryService
+
+type deliveryService struct {
+	attempts *prometheus.CounterVec
+	outcomes *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+func init() {
+	ds = deliveryMiddleware()
+}
+
+func deliveryMiddleware() *deliveryService {
+	var m deliveryService
+
+	fieldKeys := []string{"tenant", "service", "host", "outcome"}
+
+	m.attempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "delivery",
+			Subsystem: "attempt",
+			Name:      "count",
+			Help:      "Number of delivery attempts by outcome",
+		}, fieldKeys)
+	prometheus.MustRegister(m.attempts)
+
+	m.outcomes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "delivery",
+			Subsystem: "outcome",
+			Name:      "count",
+			Help:      "Number of deliveries by final outcome",
+		}, fieldKeys)
+	prometheus.MustRegister(m.outcomes)
+
+	m.latency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "delivery",
+			Subsystem: "outcome",
+			Name:      "latency_milliseconds",
+			Help:      "Time from acceptance by /notify to the final outcome in milliseconds.",
+			Buckets:   []float64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 300000},
+		}, fieldKeys)
+	prometheus.MustRegister(m.latency)
+
+	return &m
+}
+
+// DeliveryObserver reports delivery outcomes of a service.
+type DeliveryObserver struct {
+	tenantID    string
+	serviceName string
+	hosts       *hostSet
+}
+
+// NewDeliveryObserver creates DeliveryObserver. At most maxHosts destination
+// hosts are reported individually, the others are reported as "other".
+func NewDeliveryObserver(tenantID, serviceName string, maxHosts int) *DeliveryObserver {
+	return &DeliveryObserver{
+		tenantID:    tenantID,
+		serviceName: serviceName,
+		hosts:       newHostSet(maxHosts),
+	}
+}
+
+// Attempted reports the outcome of an attempt.
+func (o *DeliveryObserver) Attempted(host, outcome string) {
+	ds.attempts.WithLabelValues(o.tenantID, o.serviceName, o.hosts.label(host), outcome).Inc()
+}
+
+// Completed reports the final outcome of a delivery.
+func (o *DeliveryObserver) Completed(host, outcome string, latency time.Duration) {
+	labels := []string{o.tenantID, o.serviceName, o.hosts.label(host), outcome}
+
+	ds.outcomes.WithLabelValues(labels...).Inc()
+
+	if latency > 0 {
+		ds.latency.WithLabelValues(labels...).Observe(latency.Seconds() * 1e3)
+	}
+}
+
+// hostSet caps the number of distinct host label values.
+type hostSet struct {
+	mu    sync.RWMutex
+	max   int
+	hosts map[string]struct{}
+}
+
+func newHostSet(max int) *hostSet {
+	return &hostSet{
+		max:   max,
+		hosts: make(map[string]struct{}),
+	}
+}
+
+// label returns host while under the cap, or once already seen, and "other" otherwise.
+func (s *hostSet) label(host string) string {
+	s.mu.RLock()
+	_, ok := s.hosts[host]
+	s.mu.RUnlock()
+
+	if ok {
+		return host
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok = s.hosts[host]; ok {
+		return host
+	}
+
+	if len(s.hosts) >= s.max {
+		return otherHost
+	}
+
+	s.hosts[host] = struct{}{}
+
+	return host
+}
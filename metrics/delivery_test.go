@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hostSet_label(t *testing.T) {
+	s := newHostSet(2)
+
+	assert.Equal(t, "a.com", s.label("a.com"))
+	assert.Equal(t, "b.com", s.label("b.com"))
+	assert.Equal(t, "other", s.label("c.com"))
+	assert.Equal(t, "a.com", s.label("a.com"))
+}
@@ -1,31 +1,48 @@
 package metrics
 
 import (
+	"io"
 	"net/http"
+	"strconv"
 	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type httpService struct {
-	latency     *prometheus.HistogramVec
-	serviceName string
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
 }
 
 var ms *httpService
 
 func init() {
-	ms = metricsMiddleware("notification-service")
+	ms = metricsMiddleware()
 }
 
-// NewHTTPMiddleware wraps an http.HandlerFunc to report metrics regarding HTTP requests.
-// HTTP request duration and status code are reported.
+// NewHTTPMiddleware wraps an http.HandlerFunc to report metrics regarding HTTP requests
+// to the route name: request count, duration, in-flight requests and request/response
+// sizes, by method and status code class (2xx, 4xx...).
 func NewHTTPMiddleware(name string, handler http.HandlerFunc) http.HandlerFunc {
 	return ms.chain(name, handler)
 }
 
-func metricsMiddleware(name string) *httpService {
+func metricsMiddleware() *httpService {
 	var m httpService
-	fieldKeys := []string{"method", "endpoint"}
+	fieldKeys := []string{"method", "endpoint", "code"}
+	sizeBuckets := prometheus.ExponentialBuckets(64, 4, 8)
+
+	m.requests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "http",
+			Subsystem: "request",
+			Name:      "total",
+			Help:      "Number of requests handled.",
+		}, fieldKeys)
+	prometheus.MustRegister(m.requests)
 
 	m.latency = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -37,7 +54,34 @@ func metricsMiddleware(name string) *httpService {
 		}, fieldKeys)
 	prometheus.MustRegister(m.latency)
 
-	m.serviceName = name
+	m.inFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "http",
+			Subsystem: "request",
+			Name:      "in_flight",
+			Help:      "Number of requests being handled.",
+		}, []string{"endpoint"})
+	prometheus.MustRegister(m.inFlight)
+
+	m.requestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "http",
+			Subsystem: "request",
+			Name:      "size_bytes",
+			Help:      "Size of the request bodies in bytes.",
+			Buckets:   sizeBuckets,
+		}, fieldKeys)
+	prometheus.MustRegister(m.requestSize)
+
+	m.responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "http",
+			Subsystem: "response",
+			Name:      "size_bytes",
+			Help:      "Size of the response bodies in bytes.",
+			Buckets:   sizeBuckets,
+		}, fieldKeys)
+	prometheus.MustRegister(m.responseSize)
 
 	return &m
 }
@@ -45,28 +89,92 @@ func metricsMiddleware(name string) *httpService {
 func (m *httpService) chain(name string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		// add metrics to this method
-		defer func(start time.Time) {
-			v := float64(time.Since(start).Seconds() * 1e3)
-			m.latency.WithLabelValues(m.serviceName, name).Observe(v)
-		}(start)
+
+		inFlight := m.inFlight.WithLabelValues(name)
+		inFlight.Inc()
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
 
 		wh := &responseWriter{
 			ResponseWriter: w,
+			statusCode:     http.StatusOK,
 		}
 
+		// add metrics to this method
+		defer func() {
+			inFlight.Dec()
+
+			labels := []string{r.Method, name, codeClass(wh.statusCode)}
+
+			m.requests.WithLabelValues(labels...).Inc()
+			m.latency.WithLabelValues(labels...).Observe(time.Since(start).Seconds() * 1e3)
+			m.requestSize.WithLabelValues(labels...).Observe(float64(requestSize(r, body)))
+			m.responseSize.WithLabelValues(labels...).Observe(float64(wh.written))
+		}()
+
 		next(wh, r)
 	}
 }
 
+// codeClass returns the class of the status code: 1xx, 2xx, 3xx, 4xx or 5xx.
+func codeClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// requestSize returns the size of the request body, as declared, or as read
+// by the handler when the length is unknown.
+func requestSize(r *http.Request, body *countingReader) int64 {
+	if r.ContentLength >= 0 {
+		return r.ContentLength
+	}
+
+	return body.read
+}
+
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+// Read counts the bytes read from the request body.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.read += int64(n)
+
+	return n, err
+}
+
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	written     int64
+	wroteHeader bool
 }
 
 // WriteHeader wraps the http.ResponseWriter in order to extract
 // the status code into this package so it can be reported.
 func (w *responseWriter) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+
 	w.ResponseWriter.WriteHeader(statusCode)
-}
\ No newline at end of file
+}
+
+// Write wraps the http.ResponseWriter in order to count the bytes of the body.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_codeClass(t *testing.T) {
+	assert.Equal(t, "2xx", codeClass(http.StatusAccepted))
+	assert.Equal(t, "4xx", codeClass(http.StatusForbidden))
+	assert.Equal(t, "5xx", codeClass(http.StatusInternalServerError))
+	assert.Equal(t, "unknown", codeClass(0))
+}
+
+func Test_NewHTTPMiddleware_Reports_Method_Route_And_Code(t *testing.T) {
+	h := NewHTTPMiddleware("test_route", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("0123456789"))
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString("body"))
+	h(httptest.NewRecorder(), r)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(ms.requests.WithLabelValues(http.MethodPost, "test_route", "4xx")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(ms.inFlight.WithLabelValues("test_route")))
+}
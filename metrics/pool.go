@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var pls *poolService
+
+type poolService struct {
+	busy     *prometheus.GaugeVec
+	free     *prometheus.GaugeVec
+	wait     *prometheus.HistogramVec
+	sleeping *prometheus.GaugeVec
+	sleeps   *prometheus.CounterVec
+	// services reporting the series, by tenant and name
+	live *liveSeries
+}
+
+func init() {
+	pls = poolMiddleware()
+}
+
+func poolMiddleware() *poolService {
+	m := poolService{live: newLiveSeries()}
+
+	fieldKeys := []string{"tenant", "service"}
+
+	m.busy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "runner",
+			Subsystem: "pool",
+			Name:      "busy",
+			Help:      "Number of runners executing a task",
+		}, fieldKeys)
+	prometheus.MustRegister(m.busy)
+
+	m.free = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "runner",
+			Subsystem: "pool",
+			Name:      "free",
+			Help:      "Number of runners waiting for a task",
+		}, fieldKeys)
+	prometheus.MustRegister(m.free)
+
+	m.wait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "runner",
+			Subsystem: "pool",
+			Name:      "wait_duration_milliseconds",
+			Help:      "Time spent waiting for a free runner in milliseconds.",
+			Buckets:   []float64{0.1, 1, 5, 10, 50, 100, 500, 1000, 5000, 10000},
+		}, fieldKeys)
+	prometheus.MustRegister(m.wait)
+
+	m.sleeping = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "runner",
+			Subsystem: "retry",
+			Name:      "sleeping",
+			Help:      "Number of runners waiting before their next attempt",
+		}, fieldKeys)
+	prometheus.MustRegister(m.sleeping)
+
+	m.sleeps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "runner",
+			Subsystem: "retry",
+			Name:      "sleep_count",
+			Help:      "Number of waits before a next attempt",
+		}, fieldKeys)
+	prometheus.MustRegister(m.sleeps)
+
+	return &m
+}
+
+// PoolObserver reports the use of the runner pool of a service.
+type PoolObserver struct {
+	tenantID    string
+	serviceName string
+	size        int
+}
+
+// NewPoolObserver creates PoolObserver for a pool of size runners. The pools
+// of a service replaced by a reload run side by side for a while, so each
+// pool adds its runners to the series, and removes them when closed.
+func NewPoolObserver(tenantID, serviceName string, size int) *PoolObserver {
+	pls.live.acquire(tenantID + "/" + serviceName)
+	pls.busy.WithLabelValues(tenantID, serviceName).Add(0)
+	pls.free.WithLabelValues(tenantID, serviceName).Add(float64(size))
+
+	return &PoolObserver{
+		tenantID:    tenantID,
+		serviceName: serviceName,
+		size:        size,
+	}
+}
+
+// Close removes the runners of the pool from the series, once its tasks are
+// done, and deletes the series of the service when no other pool reports them.
+func (o *PoolObserver) Close() {
+	if !pls.live.release(o.tenantID + "/" + o.serviceName) {
+		pls.free.WithLabelValues(o.tenantID, o.serviceName).Sub(float64(o.size))
+		return
+	}
+
+	pls.busy.DeleteLabelValues(o.tenantID, o.serviceName)
+	pls.free.DeleteLabelValues(o.tenantID, o.serviceName)
+	pls.wait.DeleteLabelValues(o.tenantID, o.serviceName)
+	pls.sleeping.DeleteLabelValues(o.tenantID, o.serviceName)
+	pls.sleeps.DeleteLabelValues(o.tenantID, o.serviceName)
+}
+
+// Acquired reports a runner taken from the pool after waiting for it.
+func (o *PoolObserver) Acquired(wait time.Duration) {
+	pls.wait.WithLabelValues(o.tenantID, o.serviceName).Observe(wait.Seconds() * 1e3)
+	pls.busy.WithLabelValues(o.tenantID, o.serviceName).Inc()
+	pls.free.WithLabelValues(o.tenantID, o.serviceName).Dec()
+}
+
+// Released reports a runner put back to the pool.
+func (o *PoolObserver) Released() {
+	pls.busy.WithLabelValues(o.tenantID, o.serviceName).Dec()
+	pls.free.WithLabelValues(o.tenantID, o.serviceName).Inc()
+}
+
+// RetryObserver reports the runners of a service waiting before their next attempt.
+type RetryObserver struct {
+	tenantID    string
+	serviceName string
+}
+
+// NewRetryObserver creates RetryObserver.
+func NewRetryObserver(tenantID, serviceName string) *RetryObserver {
+	return &RetryObserver{
+		tenantID:    tenantID,
+		serviceName: serviceName,
+	}
+}
+
+// SleepStarted reports a runner starting to wait.
+func (o *RetryObserver) SleepStarted() {
+	pls.sleeps.WithLabelValues(o.tenantID, o.serviceName).Inc()
+	pls.sleeping.WithLabelValues(o.tenantID, o.serviceName).Inc()
+}
+
+// SleepEnded reports a runner done waiting.
+func (o *RetryObserver) SleepEnded() {
+	pls.sleeping.WithLabelValues(o.tenantID, o.serviceName).Dec()
+}
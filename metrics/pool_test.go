@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PoolObserver_Replaced_And_Removed(t *testing.T) {
+	previous := NewPoolObserver("tenant", "pool", 2)
+	previous.Acquired(0)
+
+	// a reload starts the new pool before the previous one is drained
+	p := NewPoolObserver("tenant", "pool", 3)
+	p.Acquired(0)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(pls.busy.WithLabelValues("tenant", "pool")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(pls.free.WithLabelValues("tenant", "pool")))
+
+	previous.Released()
+	previous.Close()
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(pls.busy.WithLabelValues("tenant", "pool")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(pls.free.WithLabelValues("tenant", "pool")))
+
+	// the service is removed
+	p.Released()
+	p.Close()
+
+	assert.False(t, pls.busy.DeleteLabelValues("tenant", "pool"))
+	assert.False(t, pls.free.DeleteLabelValues("tenant", "pool"))
+	assert.False(t, pls.wait.DeleteLabelValues("tenant", "pool"))
+}
+
+func Test_ProducerObserver_Close(t *testing.T) {
+	previous := NewProducerObserver("producer")
+	previous.Sent("topic")
+
+	o := NewProducerObserver("producer")
+	previous.Acknowledged("topic", 0)
+	previous.Close()
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(ps.buffered.WithLabelValues("topic", "producer")))
+
+	o.Sent("topic")
+	o.Failed("topic", 0)
+	o.Close()
+
+	assert.False(t, ps.buffered.DeleteLabelValues("topic", "producer"))
+	assert.False(t, ps.failed.DeleteLabelValues("topic", "producer"))
+	assert.False(t, ps.service.DeleteLabelValues("producer"))
+}
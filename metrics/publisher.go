@@ -1,7 +1,9 @@
 package metrics
 
 import (
-	"context"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -10,8 +12,13 @@ var ps *publisherService
 
 // publisherService reports metrics to prometheus
 type publisherService struct {
-	topic   *prometheus.CounterVec
-	service *prometheus.CounterVec
+	topic    *prometheus.CounterVec
+	service  *prometheus.CounterVec
+	failed   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	buffered *prometheus.GaugeVec
+	// services reporting the series
+	live *liveSeries
 }
 
 func init() {
@@ -20,14 +27,14 @@ func init() {
 
 // publisherMiddleware initializes the publisherService singleton
 func publisherMiddleware() *publisherService {
-	var m publisherService
+	m := publisherService{live: newLiveSeries()}
 
 	m.topic = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "publisher",
 			Subsystem: "topic",
 			Name:      "count",
-			Help:      "Topic count",
+			Help:      "Number of records acknowledged by the broker by topic",
 		},
 		[]string{"topic"},
 	)
@@ -38,44 +45,106 @@ func publisherMiddleware() *publisherService {
 			Namespace: "publisher",
 			Subsystem: "service",
 			Name:      "count",
-			Help:      "Service count",
+			Help:      "Number of records acknowledged by the broker by service",
 		},
 		[]string{"service"},
 	)
 	prometheus.MustRegister(m.service)
 
-	return &m
-}
+	m.failed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "publisher",
+			Subsystem: "topic",
+			Name:      "failed_count",
+			Help:      "Number of records which could not be written",
+		},
+		[]string{"topic", "service"},
+	)
+	prometheus.MustRegister(m.failed)
 
-// Publisher interface to wrap
-type Publisher interface {
-	Publish(ctx context.Context, message []byte) error
+	m.latency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "publisher",
+			Subsystem: "topic",
+			Name:      "produce_latency_milliseconds",
+			Help:      "Time from sending a record to its acknowledgement or failure in milliseconds.",
+			Buckets:   []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 5000},
+		},
+		[]string{"topic", "service", "result"},
+	)
+	prometheus.MustRegister(m.latency)
+
+	m.buffered = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "publisher",
+			Subsystem: "topic",
+			Name:      "buffered",
+			Help:      "Number of records sent and not yet acknowledged or failed",
+		},
+		[]string{"topic", "service"},
+	)
+	prometheus.MustRegister(m.buffered)
+
+	return &m
 }
 
-// publisher middleware struct
-type publisher struct {
-	next    Publisher
-	topic   string
+// ProducerObserver reports the records written by the publishers of a service.
+type ProducerObserver struct {
 	service string
+	// topics reported
+	topics sync.Map
 }
 
-// NewPublisher creates a new middleware for metrics reporting for Publisher
-func NewPublisher(p Publisher, topic, service string) Publisher {
-	return &publisher{
-		next:    p,
-		topic:   topic,
+// NewProducerObserver creates ProducerObserver for service.
+func NewProducerObserver(service string) *ProducerObserver {
+	ps.live.acquire(service)
+
+	return &ProducerObserver{
 		service: service,
 	}
 }
 
-// Send wraps the Publisher's Send fucntionality and reports metrics on topic and service
-func (h *publisher) Publish(ctx context.Context, httpRequest []byte) error {
-	err := h.next.Publish(ctx, httpRequest)
-	if err == nil {
-		ps.topic.WithLabelValues(h.topic).Inc()
-
-		ps.service.WithLabelValues(h.service).Inc()
+// Close deletes the series of the service, once its publishers are closed,
+// when no other observer reports them.
+func (o *ProducerObserver) Close() {
+	if !ps.live.release(o.service) {
+		return
 	}
 
-	return err
-}
\ No newline at end of file
+	ps.service.DeleteLabelValues(o.service)
+
+	o.topics.Range(func(topic, _ interface{}) bool {
+		t := topic.(string)
+
+		ps.topic.DeleteLabelValues(t)
+		ps.failed.DeleteLabelValues(t, o.service)
+		ps.latency.DeleteLabelValues(t, o.service, "acknowledged")
+		ps.latency.DeleteLabelValues(t, o.service, "failed")
+		ps.buffered.DeleteLabelValues(t, o.service)
+
+		return true
+	})
+}
+
+// Sent reports a record handed to the producer.
+func (o *ProducerObserver) Sent(topic string) {
+	o.topics.Store(topic, struct{}{})
+	ps.buffered.WithLabelValues(topic, o.service).Inc()
+}
+
+// Acknowledged reports a record acknowledged by the broker.
+func (o *ProducerObserver) Acknowledged(topic string, latency time.Duration) {
+	ps.buffered.WithLabelValues(topic, o.service).Dec()
+	ps.latency.WithLabelValues(topic, o.service, "acknowledged").Observe(latency.Seconds() * 1e3)
+
+	ps.topic.WithLabelValues(topic).Inc()
+	ps.service.WithLabelValues(o.service).Inc()
+}
+
+// Failed reports a record which could not be written.
+func (o *ProducerObserver) Failed(topic string, latency time.Duration) {
+	ps.buffered.WithLabelValues(topic, o.service).Dec()
+	ps.latency.WithLabelValues(topic, o.service, "failed").Observe(latency.Seconds() * 1e3)
+
+	ps.failed.WithLabelValues(topic, o.service).Inc()
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rls *reloadService
+
+type reloadService struct {
+	reloads     *prometheus.CounterVec
+	services    *prometheus.CounterVec
+	lastSuccess prometheus.Gauge
+}
+
+func init() {
+	rls = reloadMiddleware()
+}
+
+func reloadMiddleware() *reloadService {
+	var m reloadService
+
+	m.reloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "config",
+			Subsystem: "reload",
+			Name:      "count",
+			Help:      "Number of configuration reloads, by result",
+		}, []string{"result"})
+	prometheus.MustRegister(m.reloads)
+
+	m.services = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "config",
+			Subsystem: "reload",
+			Name:      "service_count",
+			Help:      "Number of services added, removed or changed by configuration reloads",
+		}, []string{"change"})
+	prometheus.MustRegister(m.services)
+
+	m.lastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "config",
+			Subsystem: "reload",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Time of the last successful configuration reload",
+		})
+	prometheus.MustRegister(m.lastSuccess)
+
+	return &m
+}
+
+// ReloadObserver reports the configuration reloads.
+type ReloadObserver struct{}
+
+// NewReloadObserver creates ReloadObserver.
+func NewReloadObserver() *ReloadObserver {
+	return &ReloadObserver{}
+}
+
+// Reloaded reports a reload applied, with the number of services added,
+// removed and changed.
+func (ReloadObserver) Reloaded(added, removed, changed int) {
+	rls.reloads.WithLabelValues("success").Inc()
+	rls.services.WithLabelValues("added").Add(float64(added))
+	rls.services.WithLabelValues("removed").Add(float64(removed))
+	rls.services.WithLabelValues("changed").Add(float64(changed))
+	rls.lastSuccess.SetToCurrentTime()
+}
+
+// Failed reports a reload which could not be applied.
+func (ReloadObserver) Failed() {
+	rls.reloads.WithLabelValues("error").Inc()
+}
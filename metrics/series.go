@@ -0,0 +1,39 @@
+package metrics
+
+import "sync"
+
+// liveSeries counts the pipelines reporting the series of a key, such as a
+// service, so that the series are deleted when the service is removed, and
+// kept when a reload replaces its pipeline: the new one starts before the
+// previous one stops.
+type liveSeries struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newLiveSeries() *liveSeries {
+	return &liveSeries{counts: make(map[string]int)}
+}
+
+// acquire records a pipeline reporting the series of key.
+func (l *liveSeries) acquire(key string) {
+	l.mu.Lock()
+	l.counts[key]++
+	l.mu.Unlock()
+}
+
+// release records a pipeline done reporting the series of key, and returns
+// true when it was the last one.
+func (l *liveSeries) release(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.counts[key]--
+	if l.counts[key] > 0 {
+		return false
+	}
+
+	delete(l.counts, key)
+
+	return true
+}
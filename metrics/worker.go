@@ -2,8 +2,6 @@ package metrics
 
 import (
 	"context"
-	"fmt"
-	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -11,26 +9,26 @@ import (
 	"github.com/tkanos/konsumerou"
 )
 
-const (
-	requestName       = "request_total"
-	requestFailedName = "request_failed"
-	latencyName       = "request_latency_milliseconds"
-)
+var wks *metricsWorker
 
 type metricsWorker struct {
 	request       *prometheus.CounterVec
 	requestFailed *prometheus.CounterVec
 	latency       *prometheus.SummaryVec
-	serviceName   string
 }
 
-// NewMetricsService creates a layer of service that add metrics capability
+func init() {
+	wks = metricsMiddlewareWorker()
+}
+
+// NewMetricsService creates a layer of service that add metrics capability.
+// The metrics of the service are labelled by its name, so a service can be
+// restarted.
 func NewMetricssWorker(serviceName string, next konsumerou.Handler) konsumerou.Handler {
-	m := metricsMiddlewareWorker(serviceName)
-	return m.instrumentation(next)
+	return wks.instrumentation(serviceName, next)
 }
 
-func metricsMiddlewareWorker(name string) *metricsWorker {
+func metricsMiddlewareWorker() *metricsWorker {
 	var m metricsWorker
 
 	fieldKeys := []string{"service"}
@@ -39,7 +37,7 @@ func metricsMiddlewareWorker(name string) *metricsWorker {
 		prometheus.CounterOpts{
 			Namespace: "consumer",
 			Subsystem: "service",
-			Name:      fmt.Sprintf("%v_%v", strings.Replace(name, "-", "_", -1), requestName),
+			Name:      "request_total",
 			Help:      "Number of requests processed",
 		}, fieldKeys)
 	prometheus.MustRegister(m.request)
@@ -48,7 +46,7 @@ func metricsMiddlewareWorker(name string) *metricsWorker {
 		prometheus.CounterOpts{
 			Namespace: "consumer",
 			Subsystem: "service",
-			Name:      fmt.Sprintf("%v_%v", strings.Replace(name, "-", "_", -1), requestFailedName),
+			Name:      "request_failed",
 			Help:      "Number of requests failed",
 		}, fieldKeys)
 	prometheus.MustRegister(m.requestFailed)
@@ -57,27 +55,27 @@ func metricsMiddlewareWorker(name string) *metricsWorker {
 		prometheus.SummaryOpts{
 			Namespace: "consumer",
 			Subsystem: "service",
-			Name:      fmt.Sprintf("%v_%v", strings.Replace(name, "-", "_", -1), latencyName),
+			Name:      "request_latency_milliseconds",
 			Help:      "Total duration in miliseconds.",
 		}, fieldKeys)
 	prometheus.MustRegister(m.latency)
 
-	m.serviceName = name
-
 	return &m
 }
 
-func (m *metricsWorker) instrumentation(next konsumerou.Handler) konsumerou.Handler {
+func (m *metricsWorker) instrumentation(serviceName string, next konsumerou.Handler) konsumerou.Handler {
 	return func(ctx context.Context, msg *sarama.ConsumerMessage) (err error) {
 		start := time.Now()
 		// add metrics to this method
-		defer m.latency.WithLabelValues(m.serviceName).Observe(time.Since(start).Seconds() * 1e3)
-		defer m.request.WithLabelValues(m.serviceName).Inc()
+		defer func() {
+			m.latency.WithLabelValues(serviceName).Observe(time.Since(start).Seconds() * 1e3)
+		}()
+		defer m.request.WithLabelValues(serviceName).Inc()
 
 		// If error is not empty, we add to metrics that it failed
 		err = next(ctx, msg)
 		if err != nil {
-			m.requestFailed.WithLabelValues(m.serviceName).Inc()
+			m.requestFailed.WithLabelValues(serviceName).Inc()
 		}
 
 		return
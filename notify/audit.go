@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
+)
+
+type submissionKey struct{}
+
+// submission collects what is known about a /notify call while it is handled,
+// to be audited once the response is sent.
+type submission struct {
+	caller          audit.Caller
+	tenantID        string
+	service         string
+	notificationID  string
+	destinationHost string
+	reason          string
+}
+
+// submissionFrom returns the submission of the request handled with ctx, if any.
+func submissionFrom(ctx context.Context) *submission {
+	s, _ := ctx.Value(submissionKey{}).(*submission)
+	return s
+}
+
+// beforeAudit starts collecting the submission from the request.
+func beforeAudit(ctx context.Context, r *http.Request) context.Context {
+	s := &submission{
+		caller: audit.Caller{
+			RemoteAddr:   r.RemoteAddr,
+			ForwardedFor: r.Header.Get("X-Forwarded-For"),
+			UserAgent:    r.UserAgent(),
+		},
+		tenantID: r.Header.Get("X-NS-TENANTID"),
+		service:  r.Header.Get("X-NS-SERVICE"),
+	}
+
+	return context.WithValue(ctx, submissionKey{}, s)
+}
+
+// makeAuditFinalizer records the decision taken on the submission.
+func makeAuditFinalizer(a audit.Auditor) func(context.Context, int, *http.Request) {
+	return func(ctx context.Context, code int, _ *http.Request) {
+		s := submissionFrom(ctx)
+		if s == nil {
+			return
+		}
+
+		decision := audit.DecisionAccepted
+		if code >= http.StatusMultipleChoices {
+			decision = audit.DecisionRejected
+		}
+
+		caller := s.caller
+
+		a.Record(ctx, audit.Record{
+			Event:           audit.EventSubmission,
+			NotificationID:  s.notificationID,
+			Caller:          &caller,
+			TenantID:        s.tenantID,
+			Service:         s.service,
+			DestinationHost: s.destinationHost,
+			Decision:        decision,
+			Reason:          s.reason,
+		})
+	}
+}
+
+// destinationHost returns the host of rawurl, or "" when it cannot be parsed.
+func destinationHost(rawurl string) string {
+	u, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
+)
+
+type mockService struct{}
+
+func (mockService) Send(context.Context, Request) (string, error) {
+	return "id", nil
+}
+
+type mockAuditor struct {
+	records []audit.Record
+}
+
+func (a *mockAuditor) Record(_ context.Context, r audit.Record) {
+	a.records = append(a.records, r)
+}
+
+func Test_Audit_Submission(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		body     string
+		decision string
+		id       string
+	}{
+		{
+			name:     "1 accepted",
+			headers:  map[string]string{"X-NS-TENANTID": "tenant", "X-NS-SERVICE": "delivery"},
+			body:     `{"type":"httpget","http_request":"http://example.com/cb?token=1"}`,
+			decision: audit.DecisionAccepted,
+			id:       "id",
+		},
+		{
+			name:     "2 rejected",
+			headers:  map[string]string{"X-NS-TENANTID": "tenant"},
+			body:     `{"type":"httpget","http_request":"http://example.com/cb"}`,
+			decision: audit.DecisionRejected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &mockAuditor{}
+			h := NewHTTPHandler(NewEndpoints(mockService{}), a)
+
+			r := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewBufferString(tt.body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Len(t, a.records, 1)
+
+			rec := a.records[0]
+			assert.Equal(t, audit.EventSubmission, rec.Event)
+			assert.Equal(t, tt.decision, rec.Decision)
+			assert.Equal(t, tt.id, rec.NotificationID)
+			assert.Equal(t, "tenant", rec.TenantID)
+			assert.Equal(t, r.RemoteAddr, rec.Caller.RemoteAddr)
+
+			if tt.decision == audit.DecisionAccepted {
+				assert.Equal(t, "example.com", rec.DestinationHost)
+				assert.Empty(t, rec.Reason)
+			} else {
+				assert.NotEmpty(t, rec.Reason)
+			}
+		})
+	}
+}
@@ -26,9 +26,28 @@ func makeEndpoint(svc Service) (ep endpoint.Endpoint) {
 			return nil, errors.Wrap(ErrRequestBodyMissingParams, err.Error())
 		}
 
+		if r.HTTPRequest != "" && (r.Path != "" || len(r.Variables) > 0) {
+			return nil, errors.Wrap(ErrInvalidParameter, "http_request excludes path and variables")
+		}
+
+		// the service sets the host of the URLs it builds from the path or
+		// variables
+		if sub := submissionFrom(ctx); sub != nil {
+			sub.destinationHost = destinationHost(r.HTTPRequest)
+		}
+
 		switch r.Type {
 		case "httpget":
-			return nil, svc.Send(ctx, r.HTTPRequest)
+			id, err := svc.Send(ctx, r)
+			if err != nil {
+				return nil, err
+			}
+
+			if sub := submissionFrom(ctx); sub != nil {
+				sub.notificationID = id
+			}
+
+			return Response{ID: id}, nil
 		default:
 			return nil, ErrInvalidParameter
 		}
@@ -42,7 +61,7 @@ func validateRequest(r Request) error {
 		s.WriteString(", type")
 	}
 
-	if r.HTTPRequest == "" {
+	if !r.hasURL() {
 		s.WriteString(", http_request")
 	}
 
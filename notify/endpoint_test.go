@@ -39,6 +39,22 @@ func Test_validateRequest(t *testing.T) {
 			r:      Request{},
 			expect: errors.New("missing fields: type, http_request"),
 		},
+		{
+			name: "5 path instead of http_request",
+			r: Request{
+				Type: "httpget",
+				Path: "/orders/1",
+			},
+			expect: nil,
+		},
+		{
+			name: "6 variables instead of http_request",
+			r: Request{
+				Type:      "httpget",
+				Variables: map[string]string{"order": "1"},
+			},
+			expect: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
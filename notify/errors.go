@@ -8,5 +8,8 @@ var ErrInvalidParameter = errors.New("invalid parameter")
 // ErrRequestBodyMissingParams is raised when the request body is missing mandatory fields
 var ErrRequestBodyMissingParams = errors.New("request body missing params")
 
+// ErrUnknownService is raised when no service is configured for the tenant and service of the request
+var ErrUnknownService = errors.New("unknown service")
+
 // ErrRequestHeaderMissingParams is raised when the request header is missing mandatory fields
 var ErrRequestHeaderMissingParams = errors.New("request header missing params")
\ No newline at end of file
@@ -7,13 +7,17 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"net/http"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
 )
 
-func NewHTTPHandler(ep Endpoints) http.Handler {
+func NewHTTPHandler(ep Endpoints, auditor audit.Auditor) http.Handler {
 	m := mux.NewRouter()
 
 	options := []kithttp.ServerOption{
+		kithttp.ServerBefore(beforeAudit, beforeRoute),
 		kithttp.ServerErrorEncoder(encodeError),
+		kithttp.ServerFinalizer(makeAuditFinalizer(auditor)),
 	}
 
 	m.Handle("/notify", kithttp.NewServer(
@@ -47,16 +51,23 @@ func decodeRequest(_ context.Context, r *http.Request) (interface{}, error) {
 // EncodeJSONResponse is a transport/http.EncodeResponseFunc that encodes
 // the response as JSON to the response writer. Primarily useful in a server.
 func encodeJSONResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusAccepted)
-	return nil
+	return json.NewEncoder(w).Encode(response)
 }
 
-func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	if sub := submissionFrom(ctx); sub != nil {
+		sub.reason = err.Error()
+	}
+
 	switch errors.Cause(err) {
 	case ErrInvalidParameter, ErrRequestBodyMissingParams:
 		w.WriteHeader(http.StatusBadRequest)
 	case ErrRequestHeaderMissingParams:
 		w.WriteHeader(http.StatusForbidden)
+	case ErrUnknownService:
+		w.WriteHeader(http.StatusNotFound)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -94,7 +105,7 @@ func validateRequestBody(rr Request) error {
 	e := ErrRequestBodyMissingParams
 	ok := true
 
-	if rr.HTTPRequest == "" {
+	if !rr.hasURL() {
 		e = errors.Wrap(e, "http_request")
 		ok = false
 	}
@@ -3,4 +3,19 @@ package notify
 type Request struct {
 	Type        string `json:"type"`
 	HTTPRequest string `json:"http_request"`
-}
\ No newline at end of file
+	// Path and Variables build the URL from the destination of the service,
+	// instead of HTTPRequest
+	Path      string            `json:"path,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// hasURL reports whether r has an http_request, or a path or variables to
+// build it.
+func (r Request) hasURL() bool {
+	return r.HTTPRequest != "" || r.Path != "" || len(r.Variables) > 0
+}
+
+// Response is returned for accepted notifications.
+type Response struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Route identifies the service a notification is sent to, by the
+// X-NS-TENANTID and X-NS-SERVICE headers of the request.
+type Route struct {
+	TenantID string
+	Service  string
+}
+
+type routeKey struct{}
+
+// RouteFrom returns the route of the request handled with ctx.
+func RouteFrom(ctx context.Context) Route {
+	r, _ := ctx.Value(routeKey{}).(Route)
+	return r
+}
+
+// beforeRoute reads the route from the request headers.
+func beforeRoute(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, routeKey{}, Route{
+		TenantID: r.Header.Get("X-NS-TENANTID"),
+		Service:  r.Header.Get("X-NS-SERVICE"),
+	})
+}
+
+// Router sends each notification with the service of its route. Services
+// can be set and removed while notifications are sent.
+type Router struct {
+	mu       sync.RWMutex
+	services map[Route]*routed
+}
+
+// routed is a service set to a route.
+type routed struct {
+	svc Service
+}
+
+// NewRouter creates a Router without services.
+func NewRouter() *Router {
+	return &Router{
+		services: make(map[Route]*routed),
+	}
+}
+
+// Set sends the notifications of route with svc, instead of the service set
+// before. The returned func stops accepting the notifications of route, unless
+// another service was set to it since.
+func (r *Router) Set(route Route, svc Service) (remove func()) {
+	set := &routed{svc: svc}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.services[route] = set
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.services[route] == set {
+			delete(r.services, route)
+		}
+	}
+}
+
+// Send sends the notification with the service of the route of ctx.
+func (r *Router) Send(ctx context.Context, req Request) (string, error) {
+	route := RouteFrom(ctx)
+
+	r.mu.RLock()
+	set, ok := r.services[route]
+	r.mu.RUnlock()
+
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownService, "%s/%s", route.TenantID, route.Service)
+	}
+
+	return set.svc.Send(ctx, req)
+}
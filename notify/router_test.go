@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
+)
+
+type namedService string
+
+func (s namedService) Send(context.Context, Request) (string, error) {
+	return string(s), nil
+}
+
+func Test_Router_Routes_By_Headers(t *testing.T) {
+	router := NewRouter()
+	router.Set(Route{TenantID: "delivery", Service: "ssp"}, namedService("ssp"))
+	removeDSP := router.Set(Route{TenantID: "delivery", Service: "dsp"}, namedService("dsp"))
+
+	h := NewHTTPHandler(NewEndpoints(router), audit.Nop())
+
+	send := func(service string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/notify",
+			bytes.NewBufferString(`{"type":"httpget","http_request":"http://example.com/cb"}`))
+		r.Header.Set("X-NS-TENANTID", "delivery")
+		r.Header.Set("X-NS-SERVICE", service)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		return rec
+	}
+
+	rec := send("dsp")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"id":"dsp"}`, rec.Body.String())
+
+	removeDSP()
+
+	rec = send("dsp")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// a replaced service does not remove the one replacing it
+	removeSSP := router.Set(Route{TenantID: "delivery", Service: "ssp"}, namedService("old"))
+	router.Set(Route{TenantID: "delivery", Service: "ssp"}, namedService("ssp"))
+	removeSSP()
+
+	rec = send("ssp")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"id":"ssp"}`, rec.Body.String())
+}
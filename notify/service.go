@@ -2,7 +2,11 @@ package notify
 
 import (
 	"context"
+	"time"
+
 	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
 	"github.com/vladimir-klymniuk/notification-service-original/message"
 )
 
@@ -14,7 +18,7 @@ var errEncoding = errors.New("error encoding message")
 
 // Service ...
 type Service interface {
-	Send(ctx context.Context, httpRequest string) error
+	Send(ctx context.Context, r Request) (string, error)
 }
 
 // Publisher publishes messages
@@ -27,36 +31,75 @@ type Encoder interface {
 	Encode(context.Context, message.Message) ([]byte, error)
 }
 
+// Destination checks that the URL of a notification can be built, and gives
+// the host it is delivered to.
+type Destination interface {
+	Check(message.Message) error
+	Host(message.Message) string
+}
+
 type service struct {
-	publisher Publisher
-	encoder   Encoder
+	publisher   Publisher
+	encoder     Encoder
+	destination Destination
+}
+
+// Option modifies service. Used in NewService.
+type Option func(*service)
+
+// WithDestination sets the destination the URLs of the notifications sent
+// with a path or variables are built from.
+func WithDestination(d Destination) Option {
+	return func(s *service) {
+		s.destination = d
+	}
 }
 
 // NewService returns an instance of a new notifier service.
 // Requires an injected publisher and encoder services.
-func NewService(publisher Publisher, encoder Encoder) Service {
-	return &service{
-		publisher: publisher,
-		encoder:   encoder,
+func NewService(publisher Publisher, encoder Encoder, options ...Option) Service {
+	s := &service{
+		publisher:   publisher,
+		encoder:     encoder,
+		destination: destination.Default(),
 	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
 }
 
 // Send wraps the provided message inside a JSON object, and publishes
-// it with the injected publisher service.
-func (s *service) Send(ctx context.Context, httpRequest string) error {
+// it with the injected publisher service. It returns the notification ID.
+// Notifications whose URL cannot be built are rejected.
+func (s *service) Send(ctx context.Context, r Request) (string, error) {
 	m := message.Message{
+		ID:          message.NewID(),
 		Type:        message.TypeHTTPGet,
-		HTTPRequest: httpRequest,
+		HTTPRequest: r.HTTPRequest,
+		Path:        r.Path,
+		Variables:   r.Variables,
+		AcceptedAt:  time.Now().UTC(),
+	}
+
+	if err := s.destination.Check(m); err != nil {
+		return "", errors.Wrap(ErrInvalidParameter, err.Error())
+	}
+
+	if sub := submissionFrom(ctx); sub != nil {
+		sub.destinationHost = s.destination.Host(m)
 	}
 
 	b, err := s.encoder.Encode(ctx, m)
 	if err != nil {
-		return errors.Wrap(errEncoding, err.Error())
+		return "", errors.Wrap(errEncoding, err.Error())
 	}
 
 	if err = s.publisher.Publish(ctx, b); err != nil {
-		return errors.Wrap(errPublishing, err.Error())
+		return "", errors.Wrap(errPublishing, err.Error())
 	}
 
-	return nil
+	return m.ID, nil
 }
\ No newline at end of file
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/message"
+)
+
+type mockPublisher struct {
+	published [][]byte
+}
+
+func (p *mockPublisher) Publish(_ context.Context, b []byte) error {
+	p.published = append(p.published, b)
+	return nil
+}
+
+func Test_service_Send_Checks_The_Destination(t *testing.T) {
+	p := &mockPublisher{}
+
+	// without destination, only http_request is accepted
+	svc := NewService(p, message.NewEncoder())
+
+	_, err := svc.Send(context.Background(), Request{Type: "httpget", Path: "/orders/1"})
+	assert.Equal(t, ErrInvalidParameter, errors.Cause(err))
+	assert.Empty(t, p.published)
+
+	d, err := destination.New(destination.Config{BaseURL: "https://partner.example"})
+	assert.NoError(t, err)
+
+	svc = NewService(p, message.NewEncoder(), WithDestination(d))
+
+	_, err = svc.Send(context.Background(), Request{Type: "httpget", Path: "//evil.example/x"})
+	assert.Equal(t, ErrInvalidParameter, errors.Cause(err))
+
+	id, err := svc.Send(context.Background(), Request{Type: "httpget", Path: "/orders/1"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	if assert.Len(t, p.published, 1) {
+		m, err := message.NewDecoder().Decode(context.Background(), p.published[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "/orders/1", m.Path)
+		assert.Equal(t, id, m.ID)
+	}
+}
+
+func Test_service_Send_Sets_The_Destination_Host(t *testing.T) {
+	d, err := destination.New(destination.Config{BaseURL: "https://partner.example/api"})
+	assert.NoError(t, err)
+
+	svc := NewService(&mockPublisher{}, message.NewEncoder(), WithDestination(d))
+
+	sub := &submission{}
+	ctx := context.WithValue(context.Background(), submissionKey{}, sub)
+
+	_, err = svc.Send(ctx, Request{Type: "httpget", Path: "/orders/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "partner.example", sub.destinationHost)
+}
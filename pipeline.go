@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
+	"github.com/vladimir-klymniuk/notification-service-original/config"
+	"github.com/vladimir-klymniuk/notification-service-original/destination"
+	"github.com/vladimir-klymniuk/notification-service-original/health"
+	"github.com/vladimir-klymniuk/notification-service-original/httpclient"
+	"github.com/vladimir-klymniuk/notification-service-original/httpget"
+	"github.com/vladimir-klymniuk/notification-service-original/inflight"
+	"github.com/vladimir-klymniuk/notification-service-original/kafka"
+	"github.com/vladimir-klymniuk/notification-service-original/keyring"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/metrics"
+	"github.com/vladimir-klymniuk/notification-service-original/notify"
+	"github.com/vladimir-klymniuk/notification-service-original/producer"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+	"github.com/vladimir-klymniuk/notification-service-original/runner"
+	"github.com/vladimir-klymniuk/notification-service-original/supervisor"
+)
+
+// pipelineFactory holds what the pipelines of the services share.
+type pipelineFactory struct {
+	cfg        *config.Configuration
+	sconfig    *sarama.Config
+	redactor   *redact.Redactor
+	auditor    audit.Auditor
+	keyring    *keyring.Keyring
+	decoder    httpget.Decoder
+	checker    *health.Checker
+	kafkaAdmin sarama.ClusterAdmin
+	tasks      *inflight.Registry
+	router     *notify.Router
+}
+
+// pipeline consumes the topic of a service and delivers its notifications,
+// and publishes the notifications sent to /notify for it.
+type pipeline struct {
+	key    string
+	route  notify.Route
+	cancel context.CancelFunc
+	// client of the consumer group, which does not close it
+	client     sarama.Client
+	group      sarama.ConsumerGroup
+	monitor    *metrics.ConsumerMonitor
+	worker     httpget.Worker
+	publishers []producer.Publisher
+	// observers deleting the series of the service once it is removed
+	pool     *metrics.PoolObserver
+	produced *metrics.ProducerObserver
+	// destination building the URLs of the notifications
+	destination *destination.Destination
+	// redactor of the logs and error topic of the service
+	redactor *redact.Redactor
+	// options of the publishers of the service
+	publisherOptions []producer.Option
+	// unregister the route and the checks of the pipeline, and not the ones
+	// of the pipeline replacing it
+	unregister []func()
+}
+
+// start starts the pipeline of service.
+func (f *pipelineFactory) start(service config.ServiceConfig) (supervisor.Pipeline, error) {
+	p := &pipeline{
+		key:   supervisor.Key(service),
+		route: notify.Route{TenantID: service.TenantID, Service: service.Name},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.redactor = serviceRedactor(f.redactor, service)
+
+	// metrics
+	producerHealth := producer.NewHealth(f.cfg.App.ProducerFailureWindow)
+	p.produced = metrics.NewProducerObserver(service.Name)
+	p.publisherOptions = []producer.Option{
+		producer.WithRedactor(p.redactor),
+		producer.WithObserver(p.produced),
+		producer.WithObserver(producerHealth),
+	}
+
+	p.unregister = append(p.unregister, f.checker.Add("producer", p.key, true, producerHealth.Check))
+
+	var err error
+	if p.destination, err = destination.New(service.Destination()); err != nil {
+		p.Stop(ctx)
+		return nil, err
+	}
+
+	if err := p.startWorker(ctx, f, service); err != nil {
+		p.Stop(ctx)
+		return nil, err
+	}
+
+	if err := p.startNotify(f, service); err != nil {
+		p.Stop(ctx)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// serviceRedactor returns r masking the default query parameters and headers
+// of service too, since they are secrets.
+func serviceRedactor(r *redact.Redactor, service config.ServiceConfig) *redact.Redactor {
+	var params, headers []string
+
+	for name := range service.Query {
+		params = append(params, name)
+	}
+
+	for name := range service.Headers {
+		headers = append(headers, name)
+	}
+
+	return r.With(params, headers)
+}
+
+// startWorker starts consuming the topic of service.
+func (p *pipeline) startWorker(ctx context.Context, f *pipelineFactory, service config.ServiceConfig) error {
+	dspErr, err := producer.NewPublisher(service.Topic, service.Error, f.cfg.Kafka.Brokers, f.sconfig, p.publisherOptions...)
+	if err != nil {
+		return errors.Wrap(err, "error creating kafka producer")
+	}
+	p.publishers = append(p.publishers, dspErr)
+
+	p.unregister = append(p.unregister, f.checker.Add("consumer_group", p.key, true, kafka.GroupMemberCheck(f.kafkaAdmin, service.GroupID, f.sconfig.ClientID)))
+
+	client, err := httpclient.New(service.Client())
+	if err != nil {
+		return err
+	}
+
+	p.pool = metrics.NewPoolObserver(service.TenantID, service.Name, service.MaxRequests)
+
+	rb := runner.NewBuilder(service.Retry, service.RetryDelay, runner.WithObserver(metrics.NewRetryObserver(service.TenantID, service.Name)))
+	mrb := metrics.NewRunnerBuilder(rb, service.Name)
+
+	p.worker = httpget.NewWorker(
+		client,
+		dspErr,
+		f.decoder,
+		service.MaxRequests,
+		mrb,
+		httpget.WithRedactor(p.redactor),
+		httpget.WithDestination(p.destination),
+		httpget.WithAuditor(f.auditor, service.TenantID, service.Name),
+		httpget.WithPoolObserver(p.pool),
+		httpget.WithDeliveryObserver(metrics.NewDeliveryObserver(service.TenantID, service.Name, f.cfg.Metrics.MaxHosts)),
+		httpget.WithRegistry(f.tasks, service.Name),
+	)
+	handler := httpget.MakeWorkerEndpoint(p.worker)
+
+	p.unregister = append(p.unregister, f.checker.Add("runner_pool", p.key, false, httpget.PoolCheck(p.worker)))
+
+	p.client, err = sarama.NewClient(f.cfg.Kafka.Brokers, f.sconfig)
+	if err != nil {
+		return errors.Wrap(err, "listener not starting")
+	}
+
+	p.group, err = sarama.NewConsumerGroupFromClient(service.GroupID, p.client)
+	if err != nil {
+		return errors.Wrap(err, "listener not starting")
+	}
+
+	go kafka.Consume(ctx, p.group, []string{service.Topic}, metrics.NewMetricssWorker(service.Name, handler))
+
+	if f.cfg.Metrics.ConsumerLagInterval > 0 {
+		p.monitor, err = metrics.NewConsumerMonitor(f.cfg.Kafka.Brokers, f.sconfig, service.GroupID, []string{service.Topic})
+		if err != nil {
+			logging.For("metrics").Error().Err(err).Str("service", p.key).Msg("unable to monitor consumer lag")
+		} else {
+			go p.monitor.Run(ctx, f.cfg.Metrics.ConsumerLagInterval)
+		}
+	}
+
+	return nil
+}
+
+// startNotify routes the notifications sent to /notify for service to its topic.
+func (p *pipeline) startNotify(f *pipelineFactory, service config.ServiceConfig) error {
+	bsp, err := producer.NewPublisher("", service.Topic, f.cfg.Kafka.Brokers, f.sconfig, p.publisherOptions...)
+	if err != nil {
+		return errors.Wrap(err, "error creating kafka producer")
+	}
+	p.publishers = append(p.publishers, bsp)
+
+	// replaces the service of the pipeline being replaced, if any
+	svc := notify.NewService(bsp, newEncoder(f.cfg, f.keyring, service), notify.WithDestination(p.destination))
+	p.unregister = append(p.unregister, f.router.Set(p.route, svc))
+
+	return nil
+}
+
+// Stop stops accepting and consuming notifications, waits for the tasks in
+// flight until ctx is done, and closes the publishers.
+func (p *pipeline) Stop(ctx context.Context) error {
+	for _, unregister := range p.unregister {
+		unregister()
+	}
+
+	// stop consuming
+	p.cancel()
+
+	if p.group != nil {
+		p.group.Close()
+	}
+
+	if p.client != nil {
+		p.client.Close()
+	}
+
+	if p.monitor != nil {
+		p.monitor.Close()
+	}
+
+	var err error
+	if p.worker != nil {
+		err = p.worker.Stop(ctx)
+	}
+
+	if p.pool != nil {
+		p.pool.Close()
+	}
+
+	for _, pub := range p.publishers {
+		if cerr := pub.Close(); cerr != nil {
+			logging.For("producer").Warn().Err(cerr).Str("service", p.key).Msg("unable to close producer")
+		}
+	}
+
+	if p.produced != nil {
+		p.produced.Close()
+	}
+
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vladimir-klymniuk/notification-service-original/audit"
+	"github.com/vladimir-klymniuk/notification-service-original/config"
+	"github.com/vladimir-klymniuk/notification-service-original/health"
+	"github.com/vladimir-klymniuk/notification-service-original/inflight"
+	"github.com/vladimir-klymniuk/notification-service-original/notify"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+)
+
+func Test_pipelineFactory_Starts_A_Service_Twice(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("ssp", 0, broker.BrokerID()).
+			SetLeader("ssp-error", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "ssp-group", broker),
+	})
+
+	sconfig := sarama.NewConfig()
+	sconfig.Version = sarama.V1_0_0_0
+	sconfig.Net.ReadTimeout = 100 * time.Millisecond
+	sconfig.Metadata.Retry.Max = 0
+
+	cfg := &config.Configuration{}
+	cfg.Kafka.Brokers = []string{broker.Addr()}
+
+	f := &pipelineFactory{
+		cfg:      cfg,
+		sconfig:  sconfig,
+		redactor: redact.Default(),
+		auditor:  audit.Nop(),
+		decoder:  newDecoder(nil),
+		checker:  health.NewChecker(time.Second),
+		tasks:    inflight.NewRegistry(),
+		router:   notify.NewRouter(),
+	}
+
+	service := config.ServiceConfig{
+		Name:        "ssp",
+		TenantID:    "delivery",
+		Topic:       "ssp",
+		Error:       "ssp-error",
+		GroupID:     "ssp-group",
+		MaxRequests: 1,
+		Retry:       1,
+	}
+
+	// a reload starts the new pipeline of a service before stopping the previous one
+	previous, err := f.start(service)
+	require.NoError(t, err)
+
+	p, err := f.start(service)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, previous.Stop(ctx))
+	require.NoError(t, p.Stop(ctx))
+
+	// the consumer group does not close the client it is built from
+	assert.True(t, previous.(*pipeline).client.Closed())
+	assert.True(t, p.(*pipeline).client.Closed())
+}
+
+func Test_serviceRedactor(t *testing.T) {
+	r := serviceRedactor(redact.New([]string{"sig"}, nil), config.ServiceConfig{
+		Query:   map[string]config.Secret{"partner_key": "env:PARTNER_KEY"},
+		Headers: map[string]config.Secret{"X-Partner-Token": "env:PARTNER_TOKEN"},
+	})
+
+	assert.Equal(t, "https://partner.example/a?sig=REDACTED&partner_key=REDACTED", r.URL("https://partner.example/a?sig=1&partner_key=2"))
+	assert.Equal(t, []string{redact.Mask}, r.Header(http.Header{"X-Partner-Token": {"t"}})["X-Partner-Token"])
+}
@@ -0,0 +1,75 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errFailing is reported while the last record could not be written.
+var errFailing = errors.New("last record could not be written")
+
+// Health is an Observer tracking whether the records are being written.
+type Health struct {
+	mu               sync.Mutex
+	lastAcknowledged time.Time
+	lastFailed       time.Time
+	buffered         int
+	// window after which a failure is forgotten
+	window time.Duration
+}
+
+// NewHealth creates Health. A failure is reported until a later record is
+// acknowledged, or for window at most, so that a transient error without
+// records afterwards does not fail the check forever.
+func NewHealth(window time.Duration) *Health {
+	return &Health{window: window}
+}
+
+// Sent records a record handed to the producer.
+func (h *Health) Sent(string) {
+	h.mu.Lock()
+	h.buffered++
+	h.mu.Unlock()
+}
+
+// Acknowledged records a record acknowledged by the broker.
+func (h *Health) Acknowledged(string, time.Duration) {
+	h.mu.Lock()
+	h.buffered--
+	h.lastAcknowledged = time.Now()
+	h.mu.Unlock()
+}
+
+// Failed records a record which could not be written.
+func (h *Health) Failed(string, time.Duration) {
+	h.mu.Lock()
+	h.buffered--
+	h.lastFailed = time.Now()
+	h.mu.Unlock()
+}
+
+// Check fails while the last record written failed, for the window at most.
+func (h *Health) Check(context.Context) (interface{}, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	details := map[string]interface{}{
+		"buffered": h.buffered,
+	}
+
+	if !h.lastAcknowledged.IsZero() {
+		details["last_acknowledged"] = h.lastAcknowledged.UTC()
+	}
+
+	if !h.lastFailed.IsZero() {
+		details["last_failed"] = h.lastFailed.UTC()
+	}
+
+	if h.lastFailed.After(h.lastAcknowledged) && time.Since(h.lastFailed) < h.window {
+		return details, errFailing
+	}
+
+	return details, nil
+}
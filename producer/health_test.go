@@ -0,0 +1,44 @@
+package producer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth_Check(t *testing.T) {
+	h := NewHealth(time.Minute)
+
+	_, err := h.Check(context.Background())
+	assert.NoError(t, err)
+
+	h.Sent("t")
+	h.Failed("t", time.Millisecond)
+
+	_, err = h.Check(context.Background())
+	assert.Equal(t, errFailing, err)
+
+	h.Sent("t")
+	h.Acknowledged("t", time.Millisecond)
+
+	details, err := h.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, details.(map[string]interface{})["buffered"])
+}
+
+func TestHealth_Check_Forgets_The_Failure_After_The_Window(t *testing.T) {
+	h := NewHealth(10 * time.Millisecond)
+
+	h.Sent("t")
+	h.Failed("t", time.Millisecond)
+
+	_, err := h.Check(context.Background())
+	assert.Equal(t, errFailing, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = h.Check(context.Background())
+	assert.NoError(t, err)
+}
@@ -2,15 +2,28 @@ package producer
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
+	"github.com/vladimir-klymniuk/notification-service-original/requestlog"
+	"github.com/vladimir-klymniuk/notification-service-original/tracing"
 )
 
+// ErrClosed is returned by Publish once the publisher is closed.
+var ErrClosed = errors.New("publisher closed")
+
 // Publisher publishes messages to a broker
 type Publisher interface {
 	Publish(ctx context.Context, message []byte) error
+	// Close flushes the buffered messages and stops the publisher.
+	Close() error
 }
 
 // publisher holds references to the producer (publisher),
@@ -21,6 +34,39 @@ type publisher struct {
 	headers   []sarama.RecordHeader
 	producer  sarama.AsyncProducer
 	timestamp func() time.Time
+	redactor  Redactor
+	observer  Observer
+	// logMessages logs the published messages
+	logMessages bool
+	// mu guards closed, the producer panics when a message is sent after
+	// it is closed
+	mu     sync.RWMutex
+	closed bool
+	// drained is done once the results of the producer are reported
+	drained sync.WaitGroup
+}
+
+// Observer is notified of the records sent to the broker and of their result.
+type Observer interface {
+	// Sent is called when a record is handed to the producer.
+	Sent(topic string)
+	// Acknowledged is called when the broker acknowledged a record, latency
+	// after it was sent.
+	Acknowledged(topic string, latency time.Duration)
+	// Failed is called when a record could not be written, latency after it
+	// was sent.
+	Failed(topic string, latency time.Duration)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) Sent(string)                        {}
+func (nopObserver) Acknowledged(string, time.Duration) {}
+func (nopObserver) Failed(string, time.Duration)       {}
+
+// Redactor masks secrets in logged messages.
+type Redactor interface {
+	Text(string) string
 }
 
 // Options that modify publisher. Used in NewPublisher.
@@ -33,22 +79,73 @@ func WithTime(f func() time.Time) Option {
 	}
 }
 
+// WithRedactor sets the redactor applied to logged messages.
+func WithRedactor(r Redactor) Option {
+	return func(p *publisher) {
+		p.redactor = r
+	}
+}
+
+// WithoutMessageLog stops logging the published messages, such as the audit
+// records, which do not belong in the operational log.
+func WithoutMessageLog() Option {
+	return func(p *publisher) {
+		p.logMessages = false
+	}
+}
+
+// WithObserver adds an observer of the records.
+func WithObserver(o Observer) Option {
+	return func(p *publisher) {
+		if _, ok := p.observer.(nopObserver); ok {
+			p.observer = o
+			return
+		}
+
+		p.observer = observers{p.observer, o}
+	}
+}
+
+// observers notifies several observers.
+type observers []Observer
+
+func (obs observers) Sent(topic string) {
+	for _, o := range obs {
+		o.Sent(topic)
+	}
+}
+
+func (obs observers) Acknowledged(topic string, latency time.Duration) {
+	for _, o := range obs {
+		o.Acknowledged(topic, latency)
+	}
+}
+
+func (obs observers) Failed(topic string, latency time.Duration) {
+	for _, o := range obs {
+		o.Failed(topic, latency)
+	}
+}
+
 // NewPublisher returns a publisher that writes to the given topic
 // at the addresses specified by the given brokers.
 // A kafka producer is created and configured for use.
 func NewPublisher(key, topic string, brokers []string, config *sarama.Config, options ...Option) (Publisher, error) {
-	producer, err := sarama.NewAsyncProducer(brokers, config)
+	// acknowledgements are required to account for the records written
+	c := *config
+	c.Producer.Return.Successes = true
+	c.Producer.Return.Errors = true
+
+	producer, err := sarama.NewAsyncProducer(brokers, &c)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Handle this error with more elegance and thought. Maybe omit this.
-	go func() {
-		for err := range producer.Errors() {
-			log.Warn().Msgf("failed to write message: %v", err)
-		}
-	}()
+	return newPublisher(producer, key, topic, options...), nil
+}
 
+// newPublisher creates the publisher and starts reporting the results of the producer.
+func newPublisher(producer sarama.AsyncProducer, key, topic string, options ...Option) *publisher {
 	// TODO: fill these from config; Maybe not required for our purposes,
 	//  and we can remove the field from the publisher struct.
 	// headers := []sarama.RecordHeader{
@@ -63,38 +160,116 @@ func NewPublisher(key, topic string, brokers []string, config *sarama.Config, op
 	// }
 
 	p := &publisher{
-		producer:  producer,
-		key:       key,
-		topic:     topic,
-		timestamp: func() time.Time { return time.Now().UTC() },
+		producer:    producer,
+		key:         key,
+		topic:       topic,
+		timestamp:   func() time.Time { return time.Now().UTC() },
+		redactor:    redact.Default(),
+		observer:    nopObserver{},
+		logMessages: true,
 	}
 
 	for _, option := range options {
 		option(p)
 	}
 
-	return p, nil
+	p.drained.Add(2)
+	go p.drainSuccesses()
+	go p.drainErrors()
+
+	return p
+}
+
+// drainSuccesses reports the records acknowledged by the broker.
+func (p *publisher) drainSuccesses() {
+	defer p.drained.Done()
+
+	for m := range p.producer.Successes() {
+		p.observer.Acknowledged(m.Topic, sentSince(m))
+	}
+}
+
+// drainErrors reports the records which could not be written.
+func (p *publisher) drainErrors() {
+	defer p.drained.Done()
+
+	for err := range p.producer.Errors() {
+		logging.For("producer").Warn().Msgf("failed to write message: %v", err)
+
+		if err.Msg != nil {
+			p.observer.Failed(err.Msg.Topic, sentSince(err.Msg))
+		}
+	}
+}
+
+// sentSince returns the time elapsed since m was sent.
+func sentSince(m *sarama.ProducerMessage) time.Duration {
+	if sent, ok := m.Metadata.(time.Time); ok {
+		return time.Since(sent)
+	}
+
+	return 0
 }
 
 // Publish creates a ProducerMessage from the provided message and writes it
-// to the producer's input channel.
-func (p *publisher) Publish(_ context.Context, message []byte) error {
+// to the producer's input channel. The trace context and request ID of ctx
+// are carried in the record headers.
+func (p *publisher) Publish(ctx context.Context, message []byte) error {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+p.topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination", p.topic),
+		),
+	)
+	defer span.End()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// a reload closes the publishers of a service, while /notify may still
+	// be publishing
+	if p.closed {
+		return ErrClosed
+	}
+
+	headers := append([]sarama.RecordHeader(nil), p.headers...)
+	tracing.Inject(ctx, tracing.ProducerCarrier{Headers: &headers})
+
 	m := &sarama.ProducerMessage{
 		Topic: p.topic,
 		// Key:       sarama.StringEncoder(p.key),
 		Value:     sarama.ByteEncoder(message),
-		Headers:   p.headers,
+		Headers:   headers,
 		Timestamp: p.timestamp(),
+		Metadata:  time.Now(),
 	}
 
-	log.Info().Msgf("new message: %s", message)
+	if p.logMessages {
+		requestlog.With(ctx, logging.Sampled("producer")).Info().Msgf("new message: %s", p.redactor.Text(string(message)))
+	}
 
+	p.observer.Sent(p.topic)
 	p.producer.Input() <- m
 
 	return nil
 }
 
-// Close wraps the producer's Close method.
+// Close wraps the producer's Close method. It waits for the messages being
+// published, the next ones are refused, and for the results of the producer
+// to be reported.
 func (p *publisher) Close() error {
-	return p.producer.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	p.closed = true
+
+	err := p.producer.Close()
+	p.drained.Wait()
+
+	return err
 }
\ No newline at end of file
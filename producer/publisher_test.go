@@ -1,13 +1,18 @@
 package producer
 
 import (
+	"bytes"
 	"context"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+	"github.com/vladimir-klymniuk/notification-service-original/redact"
 )
 
 func Test_publisher_Publish(t *testing.T) {
@@ -24,6 +29,8 @@ func Test_publisher_Publish(t *testing.T) {
 	p := &publisher{
 		producer:  producer,
 		timestamp: func() time.Time { return ts },
+		redactor:  redact.Default(),
+		observer:  nopObserver{},
 	}
 
 	message := []byte("hello sarama")
@@ -41,3 +48,76 @@ func Test_publisher_Publish(t *testing.T) {
 
 	assert.NoError(t, producer.Close())
 }
+
+type recordingObserver struct {
+	sent         chan string
+	acknowledged chan string
+	failed       chan string
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{
+		sent:         make(chan string, 2),
+		acknowledged: make(chan string, 1),
+		failed:       make(chan string, 1),
+	}
+}
+
+func (o *recordingObserver) Sent(topic string)                          { o.sent <- topic }
+func (o *recordingObserver) Acknowledged(topic string, _ time.Duration) { o.acknowledged <- topic }
+func (o *recordingObserver) Failed(topic string, _ time.Duration)       { o.failed <- topic }
+
+func Test_publisher_Reports_Acknowledged_And_Failed_Records(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	producer := mocks.NewAsyncProducer(t, config)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	o := newRecordingObserver()
+	p := newPublisher(producer, "", "topic", WithObserver(o))
+
+	assert.NoError(t, p.Publish(context.Background(), []byte("first")))
+	assert.NoError(t, p.Publish(context.Background(), []byte("second")))
+
+	for _, c := range []chan string{o.sent, o.sent, o.acknowledged, o.failed} {
+		select {
+		case topic := <-c:
+			assert.Equal(t, "topic", topic)
+		case <-time.After(1 * time.Second):
+			assert.Fail(t, "timeout")
+		}
+	}
+
+	assert.NoError(t, producer.Close())
+}
+
+func Test_publisher_Publish_Should_Return_Err_When_Closed(t *testing.T) {
+	producer := mocks.NewAsyncProducer(t, sarama.NewConfig())
+
+	p := newPublisher(producer, "", "topic")
+	assert.NoError(t, p.Close())
+
+	assert.Equal(t, ErrClosed, p.Publish(context.Background(), []byte("hello sarama")))
+	assert.Equal(t, ErrClosed, p.Close())
+}
+
+func Test_publisher_Publish_Without_Message_Log(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	producer := mocks.NewAsyncProducer(t, config)
+	producer.ExpectInputAndSucceed()
+
+	p := newPublisher(producer, "", "audit", WithoutMessageLog())
+
+	assert.NoError(t, p.Publish(context.Background(), []byte(`{"event":"delivery"}`)))
+	assert.NoError(t, p.Close())
+
+	assert.NotContains(t, buf.String(), "new message")
+}
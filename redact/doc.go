@@ -0,0 +1,4 @@
+// Package redact masks secrets carried in URLs, headers and free text before
+// they reach logs or the error topics. Sensitive query parameter and header
+// names are configurable; userinfo passwords are always masked.
+package redact
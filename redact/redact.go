@@ -0,0 +1,162 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces every redacted value.
+const Mask = "REDACTED"
+
+// DefaultQueryParams are the query parameter names redacted when none are configured.
+var DefaultQueryParams = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"auth",
+	"key",
+	"password",
+	"secret",
+	"sig",
+	"signature",
+	"token",
+}
+
+// DefaultHeaders are the header names redacted when none are configured.
+var DefaultHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// jsonAmpersand is "&" escaped by encoding/json.
+const jsonAmpersand = `\u0026`
+
+// urlPattern matches absolute URLs embedded in free text, including the
+// JSON strings, whose "&" are escaped.
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://(?:[^\s"'<>\\]|\\u0026)+`)
+
+// Redactor masks sensitive values.
+type Redactor struct {
+	params  map[string]struct{}
+	headers map[string]struct{}
+}
+
+// New creates a Redactor for the given query parameter and header names.
+// Names are matched case-insensitively.
+func New(params, headers []string) *Redactor {
+	r := &Redactor{
+		params:  make(map[string]struct{}, len(params)),
+		headers: make(map[string]struct{}, len(headers)),
+	}
+
+	for _, p := range params {
+		r.params[strings.ToLower(p)] = struct{}{}
+	}
+
+	for _, h := range headers {
+		r.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	return r
+}
+
+// Default creates a Redactor using DefaultQueryParams and DefaultHeaders.
+func Default() *Redactor {
+	return New(DefaultQueryParams, DefaultHeaders)
+}
+
+// With returns a Redactor masking params and headers too.
+func (r *Redactor) With(params, headers []string) *Redactor {
+	c := New(params, headers)
+
+	for p := range r.params {
+		c.params[p] = struct{}{}
+	}
+
+	for h := range r.headers {
+		c.headers[h] = struct{}{}
+	}
+
+	return c
+}
+
+// URL returns raw with userinfo and sensitive query values masked.
+// Values that cannot be parsed are masked entirely.
+func (r *Redactor) URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Mask
+	}
+
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Mask)
+		} else {
+			u.User = url.User(Mask)
+		}
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery = r.query(u.RawQuery)
+	}
+
+	return u.String()
+}
+
+// query masks sensitive parameters while keeping the order of the others.
+func (r *Redactor) query(raw string) string {
+	parts := strings.Split(raw, "&")
+
+	for i, part := range parts {
+		name := part
+		if n := strings.IndexByte(part, '='); n >= 0 {
+			name = part[:n]
+		}
+
+		key, err := url.QueryUnescape(name)
+		if err != nil {
+			key = name
+		}
+
+		if _, ok := r.params[strings.ToLower(key)]; ok {
+			parts[i] = name + "=" + Mask
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// Header returns a copy of h with sensitive header values masked.
+func (r *Redactor) Header(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+
+	for k, v := range h {
+		if _, ok := r.headers[http.CanonicalHeaderKey(k)]; ok {
+			c[k] = []string{Mask}
+			continue
+		}
+
+		c[k] = append([]string(nil), v...)
+	}
+
+	return c
+}
+
+// Text returns s with every URL it contains redacted.
+func (r *Redactor) Text(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		if !strings.Contains(raw, jsonAmpersand) {
+			return r.URL(raw)
+		}
+
+		// the URL of a JSON string is redacted unescaped, and escaped back
+		u := r.URL(strings.ReplaceAll(raw, jsonAmpersand, "&"))
+
+		return strings.ReplaceAll(u, "&", jsonAmpersand)
+	})
+}
@@ -0,0 +1,87 @@
+package requestlog
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+type middleware struct {
+	accessLog bool
+}
+
+// Option modifies the middleware. Used in NewHTTPMiddleware.
+type Option func(*middleware)
+
+// WithAccessLog logs each request once handled: method, route, tenant,
+// service, status and latency.
+func WithAccessLog(enabled bool) Option {
+	return func(m *middleware) {
+		m.accessLog = enabled
+	}
+}
+
+// NewHTTPMiddleware wraps an http.HandlerFunc to give each request to the route
+// name a request ID. The ID sent by the caller in the Header is kept when
+// valid, otherwise a new one is assigned; it is returned in the response
+// Header.
+func NewHTTPMiddleware(name string, next http.HandlerFunc, options ...Option) http.HandlerFunc {
+	m := &middleware{}
+
+	for _, option := range options {
+		option(m)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(Header)
+		if !validID.MatchString(id) {
+			id = NewID()
+		}
+
+		ctx := NewContext(r.Context(), id)
+		w.Header().Set(Header, id)
+
+		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(sw, r.WithContext(ctx))
+
+		if !m.accessLog {
+			return
+		}
+
+		With(ctx, logging.For("requestlog")).Info().
+			Str("method", r.Method).
+			Str("route", name).
+			Str("tenant", r.Header.Get("X-NS-TENANTID")).
+			Str("service", r.Header.Get("X-NS-SERVICE")).
+			Int("status", sw.statusCode).
+			Float64("latency_ms", time.Since(start).Seconds()*1e3).
+			Msg("request handled")
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+// WriteHeader records the status code of the response.
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write marks the header as written.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	return w.ResponseWriter.Write(b)
+}
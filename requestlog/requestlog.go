@@ -0,0 +1,90 @@
+// Package requestlog correlates the logs of a notification with the request
+// which submitted it. Each /notify request is given an X-Request-ID, or keeps
+// the one sent by the caller; the ID is attached to the logger of the request
+// context and carried, like the trace context, through the kafka record
+// headers to the worker and to its outgoing requests.
+package requestlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Header carrying the request ID.
+const Header = "X-Request-ID"
+
+// field of the request ID in the logs.
+const field = "request_id"
+
+// validID matches the request IDs accepted from callers.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type idKey struct{}
+
+// NewID returns a random request ID.
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns ctx carrying id, with a logger adding id to every event.
+func NewContext(ctx context.Context, id string) context.Context {
+	logger := log.With().Str(field, id).Logger()
+
+	return logger.WithContext(context.WithValue(ctx, idKey{}, id))
+}
+
+// FromContext returns the request ID carried by ctx, or "".
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// With returns l adding the request ID of ctx to every event, or l when ctx
+// does not carry one.
+func With(ctx context.Context, l *zerolog.Logger) *zerolog.Logger {
+	id := FromContext(ctx)
+	if id == "" {
+		return l
+	}
+
+	logger := l.With().Str(field, id).Logger()
+
+	return &logger
+}
+
+// Propagator propagates the request ID in the Header of a carrier.
+type Propagator struct{}
+
+var _ propagation.TextMapPropagator = Propagator{}
+
+// Inject writes the request ID of ctx into carrier.
+func (Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if id := FromContext(ctx); id != "" {
+		carrier.Set(Header, id)
+	}
+}
+
+// Extract returns ctx with the request ID read from carrier. ctx is returned
+// unchanged when carrier has no valid ID.
+func (Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	id := carrier.Get(Header)
+	if !validID.MatchString(id) {
+		return ctx
+	}
+
+	return NewContext(ctx, id)
+}
+
+// Fields returns the header set by Inject.
+func (Propagator) Fields() []string {
+	return []string{Header}
+}
@@ -0,0 +1,96 @@
+package requestlog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+func Test_Middleware_Keeps_Valid_Caller_ID(t *testing.T) {
+	var got string
+	h := NewHTTPMiddleware("notify", func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/notify", nil)
+	req.Header.Set(Header, "abc-123")
+	rec := httptest.NewRecorder()
+
+	h(rec, req)
+
+	assert.Equal(t, "abc-123", got)
+	assert.Equal(t, "abc-123", rec.Header().Get(Header))
+}
+
+func Test_Middleware_Assigns_ID(t *testing.T) {
+	for _, caller := range []string{"", "not valid\n"} {
+		var got string
+		h := NewHTTPMiddleware("notify", func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/notify", nil)
+		req.Header.Set(Header, caller)
+		rec := httptest.NewRecorder()
+
+		h(rec, req)
+
+		assert.Len(t, got, 32)
+		assert.Equal(t, got, rec.Header().Get(Header))
+	}
+}
+
+func Test_Middleware_Access_Log(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+
+	h := NewHTTPMiddleware("notify", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, WithAccessLog(true))
+
+	req := httptest.NewRequest(http.MethodPost, "/notify", nil)
+	req.Header.Set(Header, "abc-123")
+	req.Header.Set("X-NS-TENANTID", "tenant")
+	req.Header.Set("X-NS-SERVICE", "service")
+
+	h(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	assert.Contains(t, out, `"request_id":"abc-123"`)
+	assert.Contains(t, out, `"method":"POST"`)
+	assert.Contains(t, out, `"route":"notify"`)
+	assert.Contains(t, out, `"tenant":"tenant"`)
+	assert.Contains(t, out, `"service":"service"`)
+	assert.Contains(t, out, `"status":202`)
+	assert.Contains(t, out, `"latency_ms"`)
+}
+
+func Test_Propagator_Round_Trip(t *testing.T) {
+	carrier := propagation.HeaderCarrier(http.Header{})
+
+	Propagator{}.Inject(NewContext(context.Background(), "abc-123"), carrier)
+	assert.Equal(t, "abc-123", carrier.Get(Header))
+
+	ctx := Propagator{}.Extract(context.Background(), carrier)
+	assert.Equal(t, "abc-123", FromContext(ctx))
+}
+
+func Test_With_Adds_ID(t *testing.T) {
+	var buf bytes.Buffer
+	l := zerolog.New(&buf)
+
+	assert.Equal(t, &l, With(context.Background(), &l))
+
+	With(NewContext(context.Background(), "abc-123"), &l).Info().Msg("")
+	assert.Contains(t, buf.String(), `"request_id":"abc-123"`)
+}
@@ -10,17 +10,38 @@ type Runner interface {
 }
 
 type Builder struct {
-	retries int
-	wait    time.Duration
+	retries  int
+	wait     time.Duration
+	observer Observer
 }
 
-func NewBuilder(retries int, wait time.Duration) *Builder {
-	return &Builder{
-		retries: retries,
-		wait:    wait,
+// Option modifies Builder. Used in NewBuilder.
+type Option func(*Builder)
+
+// WithObserver sets the observer of the runners created.
+func WithObserver(o Observer) Option {
+	return func(b *Builder) {
+		b.observer = o
+	}
+}
+
+func NewBuilder(retries int, wait time.Duration, options ...Option) *Builder {
+	b := &Builder{
+		retries:  retries,
+		wait:     wait,
+		observer: nopObserver{},
 	}
+
+	for _, option := range options {
+		option(b)
+	}
+
+	return b
 }
 
 func (b *Builder) CreateRunner() Runner {
-	return newRunner(b.retries, b.wait)
+	r := newRunner(b.retries, b.wait)
+	r.observer = b.observer
+
+	return r
 }
\ No newline at end of file
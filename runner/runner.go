@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog/log"
+
+	"github.com/vladimir-klymniuk/notification-service-original/inflight"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
 )
 
 // ErrTaskFail is raised when task is failed or was not executed.
@@ -18,18 +20,31 @@ var ErrNilTask = errors.New("task is nil")
 // Task is function to execute.
 type Task func() error
 
+// Observer is notified when a runner waits before the next attempt.
+type Observer interface {
+	SleepStarted()
+	SleepEnded()
+}
+
+type nopObserver struct{}
+
+func (nopObserver) SleepStarted() {}
+func (nopObserver) SleepEnded()   {}
+
 // runner executes tasks.
 type runner struct {
-	retries int
-	wait    time.Duration
+	retries  int
+	wait     time.Duration
+	observer Observer
 }
 
 // NewRunner creates runner for task execution
 // retries is number of attempts with timeout between them.
 func newRunner(retries int, wait time.Duration) *runner {
 	return &runner{
-		retries: retries,
-		wait:    wait,
+		retries:  retries,
+		wait:     wait,
+		observer: nopObserver{},
 	}
 }
 
@@ -49,16 +64,26 @@ func (s *runner) Execute(ctx context.Context, t Task) (int, error) {
 			// no error to return
 			return i, nil
 		}
+
+		// no retry after the last attempt
+		if i == s.retries-1 {
+			break
+		}
+
 		// wait
+		s.observer.SleepStarted()
+		inflight.FromContext(ctx).Sleeping(time.Now().Add(s.wait))
 		select {
 		// wait before next attempt
 		case <-time.After(s.wait):
+			s.observer.SleepEnded()
 		// cancel runner
 		case <-ctx.Done():
+			s.observer.SleepEnded()
 			return 0, ctx.Err()
 		}
 
-		log.Info().Msgf("retries: %d", i)
+		logging.For("runner").Info().Msgf("retries: %d", i)
 	}
 
 	// return fail
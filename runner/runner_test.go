@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/inflight"
 )
 
 func Test_newRunner(t *testing.T) {
@@ -81,4 +83,64 @@ func Test_runner_Execute_Should_Return_Nil_When_Task_Returns_No_Error_On_Next_At
 
 	assert.Equal(t, 1, n)
 	assert.Nil(t, got)
-}
\ No newline at end of file
+}
+
+type countingObserver struct {
+	started int
+	ended   int
+}
+
+func (o *countingObserver) SleepStarted() { o.started++ }
+func (o *countingObserver) SleepEnded()   { o.ended++ }
+
+func Test_runner_Execute_Should_Notify_Observer_Of_Sleeps(t *testing.T) {
+	ctx := context.Background()
+	o := &countingObserver{}
+
+	r := NewBuilder(3, 1*time.Microsecond, WithObserver(o)).CreateRunner()
+
+	task := func() error { return errors.New("task") }
+
+	_, _ = r.Execute(ctx, task)
+
+	// no sleep after the last attempt
+	assert.Equal(t, 2, o.started)
+	assert.Equal(t, 2, o.ended)
+}
+
+func Test_runner_Execute_Should_Not_Wait_After_The_Last_Attempt(t *testing.T) {
+	s := newRunner(1, time.Hour)
+
+	start := time.Now()
+	n, err := s.Execute(context.Background(), func() error { return errors.New("task") })
+
+	assert.Equal(t, 1, n)
+	assert.EqualError(t, err, "task")
+	assert.True(t, time.Since(start) < time.Minute)
+}
+
+func Test_runner_Execute_Should_Report_Sleeping_Task(t *testing.T) {
+	reg := inflight.NewRegistry()
+	entry := reg.Start("ssp", "id", "example.com")
+	ctx := inflight.NewContext(context.Background(), entry)
+
+	s := newRunner(2, time.Hour)
+
+	task := func() error { return errors.New("task") }
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		for reg.Tasks()[0].State != inflight.StateSleeping {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	_, err := s.Execute(ctx, task)
+	assert.Equal(t, context.Canceled, err)
+
+	got := reg.Tasks()[0]
+	assert.Equal(t, inflight.StateSleeping, got.State)
+	assert.NotNil(t, got.NextRetry)
+	assert.True(t, got.NextRetry.After(time.Now().Add(30*time.Minute)))
+}
@@ -0,0 +1,212 @@
+// Package supervisor runs a pipeline per configured service, and applies the
+// changes of the services configuration while the service runs: pipelines of
+// new services are started, the ones of removed services are drained and
+// stopped, and the ones of changed services are replaced.
+package supervisor
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/config"
+	"github.com/vladimir-klymniuk/notification-service-original/logging"
+)
+
+// Pipeline consumes and delivers the notifications of a service.
+type Pipeline interface {
+	// Stop stops consuming, and waits for the tasks in flight to complete
+	// until ctx is done.
+	Stop(ctx context.Context) error
+}
+
+// Factory starts the pipeline of a service.
+type Factory func(config.ServiceConfig) (Pipeline, error)
+
+// Changes lists the services, as tenant/name, changed by Apply.
+type Changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether no service changed.
+func (c Changes) Empty() bool {
+	return len(c.Added)+len(c.Removed)+len(c.Changed) == 0
+}
+
+type running struct {
+	config   config.ServiceConfig
+	pipeline Pipeline
+}
+
+// Supervisor runs the pipelines of the services.
+type Supervisor struct {
+	mu           sync.Mutex
+	factory      Factory
+	drainTimeout time.Duration
+	running      map[string]running
+}
+
+// Option modifies Supervisor. Used in New.
+type Option func(*Supervisor)
+
+// WithDrainTimeout sets the time given to the tasks in flight of a stopped
+// pipeline to complete before they are cancelled.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(s *Supervisor) {
+		s.drainTimeout = d
+	}
+}
+
+// New creates a Supervisor starting pipelines with factory.
+func New(factory Factory, options ...Option) *Supervisor {
+	s := &Supervisor{
+		factory:      factory,
+		drainTimeout: 30 * time.Second,
+		running:      make(map[string]running),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
+}
+
+// Key identifies a service, as tenant/name.
+func Key(c config.ServiceConfig) string {
+	return c.TenantID + "/" + c.Name
+}
+
+// Apply makes the running pipelines match services. The pipeline of a changed
+// service is replaced by starting the new one first, so that the service keeps
+// accepting and consuming notifications; the replaced and removed pipelines
+// are drained afterwards. The pipelines which cannot be started are reported
+// in the returned error, and the pipelines they replace keep running; the
+// others are applied.
+func (s *Supervisor) Apply(ctx context.Context, services []config.ServiceConfig) (Changes, error) {
+	s.mu.Lock()
+	changes, stopped, failed := s.apply(services)
+	s.mu.Unlock()
+
+	// the pipelines replacing them already run, so the lock is not held while
+	// the tasks in flight complete
+	s.stop(ctx, stopped)
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return changes, errors.Errorf("unable to start services: %s", strings.Join(failed, "; "))
+	}
+
+	return changes, nil
+}
+
+// apply starts the pipelines of the new and changed services, and returns the
+// pipelines to stop, by service key.
+func (s *Supervisor) apply(services []config.ServiceConfig) (changes Changes, stopped map[string]Pipeline, failed []string) {
+	stopped = make(map[string]Pipeline)
+
+	wanted := make(map[string]config.ServiceConfig, len(services))
+	for _, c := range services {
+		wanted[Key(c)] = c
+	}
+
+	for key, r := range s.running {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+
+		delete(s.running, key)
+		stopped[key] = r.pipeline
+		changes.Removed = append(changes.Removed, key)
+	}
+
+	for key, c := range wanted {
+		r, ok := s.running[key]
+		if ok && reflect.DeepEqual(c, r.config) {
+			continue
+		}
+
+		p, err := s.factory(c)
+		if err != nil {
+			logging.For("supervisor").Error().Err(err).Str("service", key).Bool("previous_running", ok).Msg("unable to start service")
+			failed = append(failed, key+": "+err.Error())
+			continue
+		}
+
+		s.running[key] = running{config: c, pipeline: p}
+
+		if ok {
+			logging.For("supervisor").Info().Str("service", key).Strs("fields", diff(r.config, c)).Msg("service changed")
+			stopped[key] = r.pipeline
+			changes.Changed = append(changes.Changed, key)
+			continue
+		}
+
+		logging.For("supervisor").Info().Str("service", key).Msg("service started")
+		changes.Added = append(changes.Added, key)
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+
+	return changes, stopped, failed
+}
+
+// Stop stops every pipeline.
+func (s *Supervisor) Stop(ctx context.Context) {
+	s.mu.Lock()
+	stopped := make(map[string]Pipeline, len(s.running))
+	for key, r := range s.running {
+		stopped[key] = r.pipeline
+		delete(s.running, key)
+	}
+	s.mu.Unlock()
+
+	s.stop(ctx, stopped)
+}
+
+// stop stops the pipelines, by service key, concurrently so that each of them
+// is given the drain timeout.
+func (s *Supervisor) stop(ctx context.Context, pipelines map[string]Pipeline) {
+	ctx, cancel := context.WithTimeout(ctx, s.drainTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for key, p := range pipelines {
+		wg.Add(1)
+
+		go func(key string, p Pipeline) {
+			defer wg.Done()
+
+			if err := p.Stop(ctx); err != nil {
+				logging.For("supervisor").Warn().Err(err).Str("service", key).Msg("service stopped before its tasks completed")
+				return
+			}
+
+			logging.For("supervisor").Info().Str("service", key).Msg("service stopped")
+		}(key, p)
+	}
+	wg.Wait()
+}
+
+// diff returns the names of the fields which differ between a and b.
+func diff(a, b config.ServiceConfig) []string {
+	var fields []string
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			fields = append(fields, va.Type().Field(i).Name)
+		}
+	}
+
+	return fields
+}
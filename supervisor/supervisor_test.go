@@ -0,0 +1,139 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladimir-klymniuk/notification-service-original/config"
+)
+
+type fakePipeline struct {
+	config  config.ServiceConfig
+	stopped bool
+	// whether the pipelines started before were stopped when it started
+	startedAfterStop bool
+}
+
+func (p *fakePipeline) Stop(context.Context) error {
+	p.stopped = true
+	return nil
+}
+
+type fakeFactory struct {
+	started []*fakePipeline
+	fail    map[string]bool
+}
+
+func (f *fakeFactory) start(c config.ServiceConfig) (Pipeline, error) {
+	if f.fail[c.Name] {
+		return nil, errors.New("broken")
+	}
+
+	p := &fakePipeline{config: c}
+	for _, started := range f.started {
+		p.startedAfterStop = p.startedAfterStop || started.stopped
+	}
+
+	f.started = append(f.started, p)
+
+	return p, nil
+}
+
+func service(name string, retry int) config.ServiceConfig {
+	return config.ServiceConfig{Name: name, TenantID: "delivery", Retry: retry, MaxRequests: 1}
+}
+
+func Test_Supervisor_Apply(t *testing.T) {
+	f := &fakeFactory{}
+	s := New(f.start, WithDrainTimeout(time.Second))
+	ctx := context.Background()
+
+	changes, err := s.Apply(ctx, []config.ServiceConfig{service("ssp", 3), service("dsp", 3)})
+	assert.NoError(t, err)
+	assert.Equal(t, Changes{Added: []string{"delivery/dsp", "delivery/ssp"}}, changes)
+	assert.Len(t, f.started, 2)
+
+	// unchanged
+	changes, err = s.Apply(ctx, []config.ServiceConfig{service("dsp", 3), service("ssp", 3)})
+	assert.NoError(t, err)
+	assert.True(t, changes.Empty())
+	assert.Len(t, f.started, 2)
+
+	// ssp changed, dsp removed, rtb added
+	changes, err = s.Apply(ctx, []config.ServiceConfig{service("ssp", 5), service("rtb", 3)})
+	assert.NoError(t, err)
+	assert.Equal(t, Changes{
+		Added:   []string{"delivery/rtb"},
+		Removed: []string{"delivery/dsp"},
+		Changed: []string{"delivery/ssp"},
+	}, changes)
+
+	for _, p := range f.started[:2] {
+		assert.True(t, p.stopped, p.config.Name)
+	}
+
+	assert.Len(t, f.started, 4)
+	for _, p := range f.started[2:] {
+		assert.False(t, p.stopped, p.config.Name)
+	}
+
+	s.Stop(ctx)
+	for _, p := range f.started {
+		assert.True(t, p.stopped, p.config.Name)
+	}
+}
+
+func Test_Supervisor_Apply_Reports_Services_Not_Started(t *testing.T) {
+	f := &fakeFactory{fail: map[string]bool{"dsp": true}}
+	s := New(f.start)
+
+	changes, err := s.Apply(context.Background(), []config.ServiceConfig{service("ssp", 3), service("dsp", 3)})
+	assert.EqualError(t, err, "unable to start services: delivery/dsp: broken")
+	assert.Equal(t, []string{"delivery/ssp"}, changes.Added)
+
+	// started once fixed
+	f.fail = nil
+	changes, err = s.Apply(context.Background(), []config.ServiceConfig{service("ssp", 3), service("dsp", 3)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"delivery/dsp"}, changes.Added)
+}
+
+func Test_Supervisor_Apply_Replaces_Changed_Services(t *testing.T) {
+	f := &fakeFactory{}
+	s := New(f.start)
+	ctx := context.Background()
+
+	_, err := s.Apply(ctx, []config.ServiceConfig{service("ssp", 3)})
+	assert.NoError(t, err)
+
+	// the previous pipeline keeps running when the new one cannot start
+	f.fail = map[string]bool{"ssp": true}
+	changes, err := s.Apply(ctx, []config.ServiceConfig{service("ssp", 5)})
+	assert.EqualError(t, err, "unable to start services: delivery/ssp: broken")
+	assert.True(t, changes.Empty())
+	assert.Len(t, f.started, 1)
+	assert.False(t, f.started[0].stopped)
+
+	// the new pipeline starts before the previous one stops
+	f.fail = nil
+	changes, err = s.Apply(ctx, []config.ServiceConfig{service("ssp", 5)})
+	assert.NoError(t, err)
+	assert.Equal(t, Changes{Changed: []string{"delivery/ssp"}}, changes)
+	assert.Len(t, f.started, 2)
+	assert.True(t, f.started[0].stopped)
+	assert.False(t, f.started[1].stopped)
+	assert.False(t, f.started[1].startedAfterStop)
+}
+
+func Test_diff(t *testing.T) {
+	a := service("ssp", 3)
+	b := a
+	b.Retry = 5
+	b.Timeout = time.Second
+
+	assert.Equal(t, []string{"Retry", "Timeout"}, diff(a, b))
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// ProducerCarrier carries trace context in the headers of a produced record.
+type ProducerCarrier struct {
+	Headers *[]sarama.RecordHeader
+}
+
+// Get returns the value of key.
+func (c ProducerCarrier) Get(key string) string {
+	for _, h := range *c.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+// Set sets key to value, replacing any previous value.
+func (c ProducerCarrier) Set(key, value string) {
+	for i, h := range *c.Headers {
+		if string(h.Key) == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+
+	*c.Headers = append(*c.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys lists the header keys.
+func (c ProducerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, h := range *c.Headers {
+		keys = append(keys, string(h.Key))
+	}
+
+	return keys
+}
+
+// ConsumerCarrier reads trace context from the headers of a consumed record.
+type ConsumerCarrier []*sarama.RecordHeader
+
+// Get returns the value of key.
+func (c ConsumerCarrier) Get(key string) string {
+	for _, h := range c {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+// Set is not supported on consumed records.
+func (c ConsumerCarrier) Set(string, string) {}
+
+// Keys lists the header keys.
+func (c ConsumerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_Carrier_Propagates_Trace_Through_Record_Headers(t *testing.T) {
+	_, err := Setup(context.Background(), Config{})
+	assert.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "publish")
+	defer span.End()
+
+	headers := []sarama.RecordHeader{{Key: []byte("other"), Value: []byte("value")}}
+	Inject(ctx, ProducerCarrier{Headers: &headers})
+
+	assert.NotEmpty(t, ProducerCarrier{Headers: &headers}.Get("traceparent"))
+
+	consumed := make([]*sarama.RecordHeader, len(headers))
+	for i := range headers {
+		consumed[i] = &headers[i]
+	}
+
+	got := trace.SpanContextFromContext(Extract(context.Background(), ConsumerCarrier(consumed)))
+
+	assert.True(t, got.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), got.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), got.SpanID())
+}
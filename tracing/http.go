@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewHTTPMiddleware wraps an http.HandlerFunc in a server span named name,
+// continuing the trace of the caller when it sends a traceparent header.
+func NewHTTPMiddleware(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(sw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", sw.statusCode))
+		if sw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.statusCode))
+		}
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+// WriteHeader records the status code of the response.
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
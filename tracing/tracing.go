@@ -0,0 +1,139 @@
+// Package tracing sets up OpenTelemetry tracing. Trace context is propagated
+// with the W3C traceparent header: from incoming /notify requests, through the
+// kafka record headers, to the outgoing requests of the worker.
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pkg/errors"
+
+	"github.com/vladimir-klymniuk/notification-service-original/requestlog"
+)
+
+// Exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// name of the instrumentation library
+const name = "github.com/vladimir-klymniuk/notification-service-original"
+
+// ErrUnknownExporter is raised when the exporter is not supported.
+var ErrUnknownExporter = errors.New("unknown exporter")
+
+// Config configures the exporter of the spans.
+type Config struct {
+	// Exporter is one of ExporterOTLP, ExporterStdout, ExporterFile, or empty
+	// to propagate trace context without recording spans.
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint string
+	// Insecure disables TLS towards the collector.
+	Insecure bool
+	// Path of the file spans are written to, for ExporterFile.
+	Path string
+	// SampleRatio is the fraction of new traces recorded.
+	SampleRatio float64
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+}
+
+// Setup installs the global tracer provider and propagator, which also
+// carries the request ID of requestlog. The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		requestlog.Propagator{},
+	))
+
+	if cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closer, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes("", attribute.String("service.name", cfg.ServiceName))
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+
+		return err
+	}, nil
+}
+
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.Exporter {
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		e, err := otlptracehttp.New(ctx, options...)
+
+		return e, nil, err
+	case ExporterStdout:
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+		return e, nil, err
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+
+		return e, f, nil
+	default:
+		return nil, nil, errors.Wrap(ErrUnknownExporter, cfg.Exporter)
+	}
+}
+
+// Tracer returns the tracer of the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Inject writes the trace context of ctx into carrier.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// Extract returns ctx with the trace context read from carrier.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}